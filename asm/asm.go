@@ -0,0 +1,320 @@
+package asm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// Error describes a problem with the assembly source of a program.
+type Error struct {
+	// Pos is the position in the assembly source of the problem.
+	Pos ast.Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// argKind is the kind of argument a command takes.
+type argKind uint8
+
+const (
+	argNone argKind = iota
+	argNumber
+	argLabel
+)
+
+// mnemonics maps each mnemonic to its command.
+var mnemonics = map[string]ast.Cmd{
+	"label": ast.CmdMark,
+}
+
+func init() {
+	for c := ast.CmdNone + 1; c < ast.CountCmds; c++ {
+		mnemonics[c.String()] = c
+	}
+}
+
+func argKindOf(c ast.Cmd) argKind {
+	switch c {
+	case ast.CmdPush, ast.CmdCopy, ast.CmdSlide:
+		return argNumber
+	case ast.CmdMark, ast.CmdCall, ast.CmdJump, ast.CmdJumpIfZero,
+		ast.CmdJumpIfNeg:
+		return argLabel
+	}
+	return argNone
+}
+
+// Assemble reads an assembly program from r, and returns its commands.
+//
+// Each line holds one command: a mnemonic (as returned by ast.Cmd.String,
+// or "label" for mark), followed by its argument if it takes one. A line
+// can also be just "NAME:", which marks the label NAME. Anything after a
+// ';' that is not in a character literal is a comment.
+//
+// Number arguments can be written in decimal, in hex, octal or binary
+// with a 0x, 0o or 0b prefix, or as a Go character literal like 'a' or
+// '\n'. They are returned as int64 values if they fit, and as *big.Int
+// values otherwise.
+//
+// Label arguments are symbolic names, which are given label bits in the
+// order they first appear in the source. A label name can also be given
+// as raw bits in the form returned by LabelBits, prefixed by '%', like
+// %STTS, which is used as it is.
+//
+// The position of each command is its position in the assembly source.
+func Assemble(r io.Reader) ([]ast.Command, error) {
+	a := &assembler{defined: map[string]bool{}, used: map[string]ast.Pos{}}
+	src := bufio.NewScanner(r)
+	src.Split(scanLines)
+	pos := ast.StartPos
+	for src.Scan() {
+		line := strings.TrimSuffix(src.Text(), "\n")
+		if err := a.line(strings.TrimSuffix(line, "\r"), pos); err != nil {
+			return nil, err
+		}
+		for _, b := range src.Bytes() {
+			pos.Advance(b)
+		}
+	}
+	if err := src.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range a.order {
+		if !a.defined[name] {
+			return nil, &Error{
+				Pos: a.used[name],
+				Msg: fmt.Sprintf("undefined label: %v", name),
+			}
+		}
+	}
+	bits := a.labelBits()
+	for i, c := range a.cmds {
+		if argKindOf(c.Cmd) == argLabel {
+			a.cmds[i].Arg = bits[c.Arg.(string)]
+		}
+	}
+	return a.cmds, nil
+}
+
+// scanLines is a split function like bufio.ScanLines, except that it
+// keeps the line terminator, so that the position of every line in the
+// source is known even if it has CRLF line endings.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+type assembler struct {
+	cmds []ast.Command
+
+	// order holds the label names in the order they were first used,
+	// used holds where that was, and defined holds the labels that have
+	// been marked. Labels given as raw bits are named by their bits as
+	// returned by LabelBits, with the '%' prefix.
+	order   []string
+	used    map[string]ast.Pos
+	defined map[string]bool
+}
+
+// line assembles one line of source, which starts at the given position.
+func (a *assembler) line(text string, pos ast.Pos) error {
+	tokens, err := tokenize(text, pos)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	cmd, ok := mnemonics[strings.ToLower(tokens[0].text)]
+	args := tokens[1:]
+	switch {
+	case ok:
+	case len(tokens) == 1 && strings.HasSuffix(tokens[0].text, ":"):
+		cmd, args = ast.CmdMark, tokens
+	default:
+		return &Error{
+			Pos: tokens[0].pos,
+			Msg: fmt.Sprintf("unknown instruction: %v", tokens[0].text),
+		}
+	}
+
+	want := 1
+	if argKindOf(cmd) == argNone {
+		want = 0
+	}
+	if len(args) != want {
+		return &Error{
+			Pos: tokens[0].pos,
+			Msg: fmt.Sprintf(
+				"%v takes %d argument(s), got %d", cmd, want, len(args),
+			),
+		}
+	}
+
+	c := ast.Command{Cmd: cmd, Pos: tokens[0].pos}
+	switch argKindOf(cmd) {
+	case argNumber:
+		c.Arg, err = parseNumber(args[0])
+	case argLabel:
+		c.Arg, err = a.label(args[0], cmd == ast.CmdMark)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.cmds = append(a.cmds, c)
+	return nil
+}
+
+// label parses a label argument, returning the name of the label.
+func (a *assembler) label(t token, mark bool) (string, error) {
+	name := t.text
+	if mark {
+		name = strings.TrimSuffix(name, ":")
+	}
+	if name == "" {
+		return "", &Error{Pos: t.pos, Msg: "missing label name"}
+	}
+	if strings.HasPrefix(name, "%") {
+		bits, err := ParseLabelBits(name[1:])
+		if err != nil {
+			return "", &Error{Pos: t.pos, Msg: err.Error()}
+		}
+		name = "%" + LabelBits(bits)
+	}
+
+	if _, ok := a.used[name]; !ok {
+		a.order = append(a.order, name)
+		a.used[name] = t.pos
+	}
+	if mark {
+		if a.defined[name] {
+			return "", &Error{
+				Pos: t.pos, Msg: fmt.Sprintf("duplicate label: %v", name),
+			}
+		}
+		a.defined[name] = true
+	}
+	return name, nil
+}
+
+// labelBits returns the bits of every label, by name. Labels that were
+// given as raw bits get those bits, while the others get the shortest
+// bits that are not used by any other label, in the order they were
+// first used. The empty label is not used, since not all interpreters
+// support it.
+func (a *assembler) labelBits() map[string]string {
+	bits := map[string]string{}
+	taken := map[string]bool{}
+	for _, name := range a.order {
+		if strings.HasPrefix(name, "%") {
+			bits[name], _ = ParseLabelBits(name[1:])
+			taken[bits[name]] = true
+		}
+	}
+	n := uint64(0)
+	for _, name := range a.order {
+		if strings.HasPrefix(name, "%") {
+			continue
+		}
+		for {
+			n++
+			if b := ast.NumberedLabel(n); !taken[b] {
+				bits[name] = b
+				break
+			}
+		}
+	}
+	return bits
+}
+
+type token struct {
+	text string
+	pos  ast.Pos
+}
+
+// tokenize splits a line of source into tokens, removing any comment.
+func tokenize(text string, pos ast.Pos) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case ' ', '\t', '\r':
+			pos.Advance(text[i])
+			i++
+			continue
+		case ';':
+			return tokens, nil
+		}
+
+		start := i
+		if text[i] == '\'' {
+			// A character literal, which can contain spaces and ';'
+			i++
+			for i < len(text) && text[i] != '\'' {
+				if text[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(text) {
+				return nil, &Error{
+					Pos: pos, Msg: "unterminated character literal",
+				}
+			}
+			i++
+		} else {
+			for i < len(text) && strings.IndexByte(" \t\r;", text[i]) < 0 {
+				i++
+			}
+		}
+
+		tokens = append(tokens, token{text: text[start:i], pos: pos})
+		for _, b := range []byte(text[start:i]) {
+			pos.Advance(b)
+		}
+	}
+	return tokens, nil
+}
+
+// parseNumber parses a number argument.
+func parseNumber(t token) (interface{}, error) {
+	if strings.HasPrefix(t.text, "'") {
+		lit := t.text[1 : len(t.text)-1]
+		v, _, tail, err := strconv.UnquoteChar(lit, '\'')
+		if err != nil || tail != "" {
+			return nil, &Error{
+				Pos: t.pos,
+				Msg: fmt.Sprintf("invalid character literal: %v", t.text),
+			}
+		}
+		return int64(v), nil
+	}
+
+	v, ok := new(big.Int).SetString(t.text, 0)
+	if !ok {
+		return nil, &Error{
+			Pos: t.pos, Msg: fmt.Sprintf("invalid number: %v", t.text),
+		}
+	}
+	if v.IsInt64() {
+		return v.Int64(), nil
+	}
+	return v, nil
+}
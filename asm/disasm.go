@@ -0,0 +1,110 @@
+// Package asm implements a human-readable assembly language for
+// Whitespace programs.
+//
+// Each command is written on its own line, as its mnemonic (the name
+// returned by ast.Cmd.String) followed by its argument, if it has one.
+// Labels are given readable names, and are marked with "label NAME:".
+// Anything after a ';' is a comment.
+package asm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// Disassemble writes an assembly listing of the given commands to w.
+//
+// The labels are named L0, L1, and so on, in the order they are marked.
+// Each line ends with a comment giving the source position of the
+// command, and the raw bits of its label (if any), as given by
+// LabelBits.
+func Disassemble(w io.Writer, cmds []ast.Command) error {
+	names := labelNames(cmds)
+	for _, c := range cmds {
+		var text, bits string
+		switch c.Cmd {
+		case ast.CmdMark:
+			label, _ := c.Arg.(string)
+			text = fmt.Sprintf("label %s:", names[label])
+			bits = LabelBits(label)
+		case ast.CmdCall, ast.CmdJump, ast.CmdJumpIfZero, ast.CmdJumpIfNeg:
+			label, _ := c.Arg.(string)
+			text = fmt.Sprintf("    %v %s", c.Cmd, names[label])
+			bits = LabelBits(label)
+		default:
+			text = fmt.Sprintf("    %v", c.Cmd)
+			if c.Arg != nil {
+				text += fmt.Sprintf(" %v", c.Arg)
+			}
+		}
+
+		line := fmt.Sprintf("%-24s ; %v", text, c.Pos)
+		if bits != "" {
+			line += ", label " + bits
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelNames returns readable names for the labels used by the given
+// commands, numbered first in the order they are marked, and then in
+// the order they are used for any labels that are never marked.
+func labelNames(cmds []ast.Command) map[string]string {
+	names := map[string]string{}
+	add := func(c ast.Command) {
+		label, _ := c.Arg.(string)
+		if _, ok := names[label]; !ok {
+			names[label] = fmt.Sprintf("L%d", len(names))
+		}
+	}
+	for _, c := range cmds {
+		if c.Cmd == ast.CmdMark {
+			add(c)
+		}
+	}
+	for _, c := range cmds {
+		switch c.Cmd {
+		case ast.CmdCall, ast.CmdJump, ast.CmdJumpIfZero, ast.CmdJumpIfNeg:
+			add(c)
+		}
+	}
+	return names
+}
+
+// LabelBits returns the raw bits of a label in readable form, with S for
+// each space and T for each tab, or `""` for the empty label.
+func LabelBits(label string) string {
+	if label == "" {
+		return `""`
+	}
+	return strings.NewReplacer(" ", "S", "\t", "T").Replace(label)
+}
+
+// ParseLabelBits parses the raw bits of a label as returned by
+// LabelBits. Lowercase s and t are accepted as well.
+func ParseLabelBits(bits string) (string, error) {
+	if bits == `""` {
+		return "", nil
+	}
+	var sb strings.Builder
+	for _, c := range strings.ToUpper(bits) {
+		switch c {
+		case 'S':
+			sb.WriteByte(' ')
+		case 'T':
+			sb.WriteByte('\t')
+		default:
+			return "", fmt.Errorf(
+				"invalid label %q: must be made of S (space) and T (tab)",
+				bits,
+			)
+		}
+	}
+	return sb.String(), nil
+}
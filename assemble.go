@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/edorfaus/whitespace/asm"
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// assembleProgram assembles the assembly program in the given file, and
+// writes it to stdout as Whitespace source.
+func assembleProgram(fn string) (retErr error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	cmds, err := asm.Assemble(f)
+	if err != nil {
+		return err
+	}
+
+	e := ast.NewEncoder(os.Stdout)
+	for _, c := range cmds {
+		if *comments {
+			text := c.Cmd.String()
+			if _, ok := c.Arg.(string); !ok && c.Arg != nil {
+				text += fmt.Sprint(" ", c.Arg)
+			}
+			e.Comment(text)
+		}
+		if err := e.Encode(c); err != nil {
+			return err
+		}
+	}
+	return e.Flush()
+}
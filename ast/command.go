@@ -1,8 +1,16 @@
 package ast
 
+import (
+	"fmt"
+)
+
 type Command struct {
 	Cmd Cmd
+	// Arg is the argument of the command, if it has one: a string for
+	// the label commands, and an int64 or a *big.Int for the others.
 	Arg interface{}
+	// Pos is the position of the first byte of the command's IMP.
+	Pos Pos
 }
 
 type Cmd uint8
@@ -42,3 +50,19 @@ const (
 	// Total count of commands
 	CountCmds
 )
+
+var cmdNames = [CountCmds]string{
+	"none",
+	"push", "dup", "copy", "swap", "discard", "slide",
+	"add", "sub", "mul", "div", "mod",
+	"store", "retrieve",
+	"mark", "call", "jump", "jz", "jn", "ret", "exit",
+	"outc", "outn", "readc", "readn",
+}
+
+func (c Cmd) String() string {
+	if c < CountCmds {
+		return cmdNames[c]
+	}
+	return fmt.Sprintf("Cmd(%d)", uint8(c))
+}
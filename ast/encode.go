@@ -0,0 +1,198 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// cmdBytes holds the IMP and command bytes of each command.
+var cmdBytes = [CountCmds]string{
+	CmdPush:       "  ",
+	CmdDup:        " \n ",
+	CmdCopy:       " \t ",
+	CmdSwap:       " \n\t",
+	CmdDiscard:    " \n\n",
+	CmdSlide:      " \t\n",
+	CmdAdd:        "\t   ",
+	CmdSub:        "\t  \t",
+	CmdMul:        "\t  \n",
+	CmdDiv:        "\t \t ",
+	CmdMod:        "\t \t\t",
+	CmdStore:      "\t\t ",
+	CmdRetrieve:   "\t\t\t",
+	CmdMark:       "\n  ",
+	CmdCall:       "\n \t",
+	CmdJump:       "\n \n",
+	CmdJumpIfZero: "\n\t ",
+	CmdJumpIfNeg:  "\n\t\t",
+	CmdReturn:     "\n\t\n",
+	CmdExit:       "\n\n\n",
+	CmdOutChar:    "\t\n  ",
+	CmdOutNumber:  "\t\n \t",
+	CmdReadChar:   "\t\n\t ",
+	CmdReadNumber: "\t\n\t\t",
+}
+
+// bitsReplacer turns binary digits into Whitespace bits.
+var bitsReplacer = strings.NewReplacer("0", " ", "1", "\t")
+
+// Encoder writes commands to an io.Writer as Whitespace source.
+//
+// Numbers are written in their shortest form, which has no leading zero
+// bits (so zero has no bits at all), and a positive sign for zero.
+type Encoder struct {
+	w   *bufio.Writer
+	err error
+
+	// labels maps each label to its normalized form, if labels are
+	// being normalized.
+	labels map[string]string
+}
+
+// EncoderOption is an option that changes how an Encoder works.
+type EncoderOption func(*Encoder)
+
+// WithNormalizedLabels makes the encoder replace each label by the
+// shortest label that has not already been used, in the order they are
+// first seen, so that equivalent programs get identical labels. The
+// empty label is not used, since not all interpreters support it.
+func WithNormalizedLabels() EncoderOption {
+	return func(e *Encoder) {
+		e.labels = map[string]string{}
+	}
+}
+
+func NewEncoder(w io.Writer, opts ...EncoderOption) *Encoder {
+	e := &Encoder{w: bufio.NewWriter(w)}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Encode writes the given commands to w as Whitespace source.
+func Encode(w io.Writer, cmds []Command, opts ...EncoderOption) error {
+	e := NewEncoder(w, opts...)
+	for _, c := range cmds {
+		if err := e.Encode(c); err != nil {
+			return err
+		}
+	}
+	return e.Flush()
+}
+
+// Encode writes a command. The output is buffered, so Flush must be
+// called after the last command.
+func (e *Encoder) Encode(c Command) error {
+	if e.err != nil {
+		return e.err
+	}
+	if c.Cmd == CmdNone || c.Cmd >= CountCmds {
+		return e.fail("invalid command: %v", c.Cmd)
+	}
+	e.w.WriteString(cmdBytes[c.Cmd])
+
+	switch c.Cmd {
+	case CmdPush, CmdCopy, CmdSlide:
+		switch v := c.Arg.(type) {
+		case int64:
+			e.writeInt(v)
+		case *big.Int:
+			e.writeBig(v)
+		default:
+			return e.fail(
+				"%v: expected number argument, got %T", c.Cmd, c.Arg,
+			)
+		}
+	case CmdMark, CmdCall, CmdJump, CmdJumpIfZero, CmdJumpIfNeg:
+		label, ok := c.Arg.(string)
+		if !ok {
+			return e.fail(
+				"%v: expected label argument, got %T", c.Cmd, c.Arg,
+			)
+		}
+		if strings.Trim(label, " \t") != "" {
+			return e.fail("%v: invalid label: %q", c.Cmd, label)
+		}
+		e.writeLabel(label)
+	}
+	return e.err
+}
+
+// Comment writes the given text as a comment. Since spaces, tabs and
+// line feeds would be read as code, each of them is written as '_'.
+func (e *Encoder) Comment(text string) error {
+	if e.err != nil {
+		return e.err
+	}
+	_, e.err = commentReplacer.WriteString(e.w, text)
+	return e.err
+}
+
+var commentReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_")
+
+// Flush writes any buffered output to the underlying writer.
+func (e *Encoder) Flush() error {
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
+
+func (e *Encoder) fail(format string, args ...interface{}) error {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+	return e.err
+}
+
+func (e *Encoder) writeInt(v int64) {
+	abs := uint64(v)
+	if v < 0 {
+		e.w.WriteByte('\t')
+		abs = uint64(-v)
+	} else {
+		e.w.WriteByte(' ')
+	}
+	if abs != 0 {
+		bitsReplacer.WriteString(e.w, strconv.FormatUint(abs, 2))
+	}
+	e.w.WriteByte('\n')
+}
+
+func (e *Encoder) writeBig(v *big.Int) {
+	if v.Sign() < 0 {
+		e.w.WriteByte('\t')
+	} else {
+		e.w.WriteByte(' ')
+	}
+	if v.Sign() != 0 {
+		bitsReplacer.WriteString(e.w, new(big.Int).Abs(v).Text(2))
+	}
+	e.w.WriteByte('\n')
+}
+
+func (e *Encoder) writeLabel(label string) {
+	if e.labels != nil {
+		norm, ok := e.labels[label]
+		if !ok {
+			norm = NumberedLabel(uint64(len(e.labels)) + 1)
+			e.labels[label] = norm
+		}
+		label = norm
+	}
+	e.w.WriteString(label)
+	e.w.WriteByte('\n')
+}
+
+// NumberedLabel returns the label with the given number, which must be
+// at least 1. That is the binary form of n+1 without its leading 1 bit,
+// so that every number gets a different label that is not empty, with
+// the shortest labels first.
+func NumberedLabel(n uint64) string {
+	return bitsReplacer.Replace(strconv.FormatUint(n+1, 2)[1:])
+}
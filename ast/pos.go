@@ -0,0 +1,40 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// Pos is a position in the source code of a program.
+//
+// The line and column are 0 if they are not known, which is the case
+// when reading the source from somewhere other than its start.
+type Pos struct {
+	Offset int64 // byte offset, starting at 0
+	Line   int   // line number, starting at 1
+	Column int   // column number (in bytes), starting at 1
+}
+
+// StartPos is the position of the first byte of a source file.
+var StartPos = Pos{Offset: 0, Line: 1, Column: 1}
+
+// Advance updates the position to be just after the given byte.
+func (p *Pos) Advance(b byte) {
+	p.Offset++
+	if p.Line == 0 {
+		// The line and column are not known
+		return
+	}
+	if b == '\n' {
+		p.Line++
+		p.Column = 1
+	} else {
+		p.Column++
+	}
+}
+
+func (p Pos) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("offset %d", p.Offset)
+	}
+	return fmt.Sprintf("%d:%d (offset %d)", p.Line, p.Column, p.Offset)
+}
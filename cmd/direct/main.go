@@ -0,0 +1,202 @@
+// Command direct runs a Whitespace program with the direct interpreter,
+// which executes the code directly from the source file as it goes,
+// instead of parsing it up-front.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/edorfaus/whitespace/direct"
+	"github.com/edorfaus/whitespace/interp"
+)
+
+var division = flag.String(
+	"div", "trunc",
+	"rounding of div and mod: trunc (toward zero) or floor (like Haskell)",
+)
+
+var eof = flag.String(
+	"eof", "error",
+	"what readc and readn do at end of input: error, unchanged (leave"+
+		" the heap unchanged), or a number to store (usually -1 or 0)",
+)
+
+var spoolDir = flag.String(
+	"spool-dir", "",
+	"directory for the temporary file used to hold a program that is"+
+		" read from a pipe (default is the system temp directory)",
+)
+
+var useIndex = flag.Bool(
+	"use-index", true,
+	"use the label index in FILE.idx if there is one, as made by the"+
+		" index command, unless it is out of date",
+)
+
+var verifyIndex = flag.Bool(
+	"verify-index", false,
+	"check that the label index is up to date by hashing the program,"+
+		" instead of trusting it if the file's size and time match",
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if flag.Arg(0) == "index" {
+		if flag.NArg() != 2 {
+			return errors.New("usage: direct index FILE")
+		}
+		return indexProgram(flag.Arg(1))
+	}
+
+	fn := "hello-world.ws"
+	if flag.NArg() > 0 {
+		fn = flag.Arg(0)
+	}
+	return runProgram(fn)
+}
+
+func runProgram(fn string) (retErr error) {
+	// The program can be read from stdin, but then that cannot also be
+	// used for the program's input.
+	var stdin io.Reader = os.Stdin
+	if fn == "-" {
+		stdin = strings.NewReader("")
+	}
+
+	eofPolicy, eofValue, err := interp.ParseEOFPolicy(*eof)
+	if err != nil {
+		return err
+	}
+	div, err := interp.ParseDivision(*division)
+	if err != nil {
+		return err
+	}
+	opts := []direct.Option{
+		direct.WithIO(interp.NewIO(stdin, os.Stdout)),
+		direct.WithEOF(eofPolicy, eofValue),
+		direct.WithDivision(div),
+	}
+
+	file := os.Stdin
+	if fn != "-" {
+		if file, err = os.Open(fn); err != nil {
+			return err
+		}
+		defer closeFile(file, &retErr)
+	}
+
+	var src io.ReadSeeker = file
+	_, err = file.Seek(0, io.SeekCurrent)
+	if err == nil && *useIndex {
+		x, err := loadIndex(fn, file)
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			opts = append(opts, direct.WithIndex(x))
+		}
+	}
+	if err != nil {
+		// Not seekable, probably a pipe, so spool it to a file to be
+		// able to seek back to it when jumping.
+		spool, err := direct.NewSpool(file, *spoolDir)
+		if err != nil {
+			return err
+		}
+		defer closeFile(spool, &retErr)
+		src = spool
+	}
+
+	return direct.New(src, opts...).Run()
+}
+
+// indexFile returns the name of the label index file for a program.
+func indexFile(fn string) string {
+	return fn + ".idx"
+}
+
+// indexProgram writes a label index for the program in the given file.
+func indexProgram(fn string) (retErr error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer closeFile(file, &retErr)
+
+	x, err := direct.BuildIndex(file)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(indexFile(fn))
+	if err != nil {
+		return err
+	}
+	defer closeFile(out, &retErr)
+	_, err = x.WriteTo(out)
+	return err
+}
+
+// loadIndex loads the label index for the program in the given file, if
+// there is one and it is up to date, and returns nil otherwise.
+func loadIndex(fn string, file *os.File) (_ *direct.Index, retErr error) {
+	in, err := os.Open(indexFile(fn))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(in, &retErr)
+
+	x, err := direct.ReadIndex(in)
+	if err != nil {
+		// Like an out of date index, this should not stop the program
+		// from running, as it can run without the index.
+		fmt.Fprintf(
+			os.Stderr, "Warning: ignoring label index %v: %v\n",
+			indexFile(fn), err,
+		)
+		return nil, nil
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// Hashing reads the whole program, so only do that if asked to, or
+	// if the file might have changed.
+	ok := x.Matches(fi) && !*verifyIndex
+	if !ok {
+		if ok, err = x.Valid(file); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		fmt.Fprintln(
+			os.Stderr, "Warning: ignoring out of date label index:",
+			indexFile(fn),
+		)
+		return nil, nil
+	}
+	return x, nil
+}
+
+// closeFile closes the given file, setting *retErr to the error if that
+// fails and it is not already set.
+func closeFile(f io.Closer, retErr *error) {
+	if err := f.Close(); err != nil && *retErr == nil {
+		*retErr = err
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+
+	"github.com/edorfaus/whitespace/debugger"
+)
+
+// debugProgram runs the program in the given file under the interactive
+// debugger, which reads its commands from the same input as the program.
+func debugProgram(fn string) error {
+	vm, err := loadProgram(fn)
+	if err != nil {
+		return err
+	}
+	return debugger.New(vm, stdin, os.Stdout).Run()
+}
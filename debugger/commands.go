@@ -0,0 +1,452 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/edorfaus/whitespace/asm"
+	"github.com/edorfaus/whitespace/ast"
+)
+
+type command struct {
+	names []string
+	args  string
+	help  string
+	run   func(d *Debugger, args []string) error
+	quit  bool
+}
+
+// commandList is set in init, since the help command refers to it.
+var commandList []command
+
+func init() {
+	commandList = []command{
+		{
+			names: []string{"help", "h", "?"},
+			help:  "show this help",
+			run:   (*Debugger).cmdHelp,
+		},
+		{
+			names: []string{"step", "s"},
+			args:  "[count]",
+			help:  "execute one instruction, or count instructions",
+			run:   (*Debugger).cmdStep,
+		},
+		{
+			names: []string{"next", "n"},
+			help:  "like step, but run a call until it returns",
+			run:   (*Debugger).cmdNext,
+		},
+		{
+			names: []string{"finish", "fin"},
+			help:  "run until the current call returns",
+			run:   (*Debugger).cmdFinish,
+		},
+		{
+			names: []string{"continue", "c"},
+			help:  "run until a breakpoint or watchpoint is hit",
+			run:   (*Debugger).cmdContinue,
+		},
+		{
+			names: []string{"break", "b"},
+			args:  "index | line <line> | label <label>",
+			help: "set a breakpoint on an instruction index, the first" +
+				" instruction on or after a source line, or a label",
+			run: (*Debugger).cmdBreak,
+		},
+		{
+			names: []string{"delete", "d"},
+			args:  "index | all",
+			help:  "remove a breakpoint, or all of them",
+			run:   (*Debugger).cmdDelete,
+		},
+		{
+			names: []string{"watch", "w"},
+			args:  "address",
+			help:  "stop when the value of a heap cell changes",
+			run:   (*Debugger).cmdWatch,
+		},
+		{
+			names: []string{"unwatch"},
+			args:  "address | all",
+			help:  "remove a watchpoint, or all of them",
+			run:   (*Debugger).cmdUnwatch,
+		},
+		{
+			names: []string{"info", "i"},
+			help:  "list the breakpoints and watchpoints",
+			run:   (*Debugger).cmdInfo,
+		},
+		{
+			names: []string{"where"},
+			help:  "show the current instruction",
+			run:   (*Debugger).cmdWhere,
+		},
+		{
+			names: []string{"list", "l"},
+			args:  "[index] [count]",
+			help:  "list instructions around the current one or an index",
+			run:   (*Debugger).cmdList,
+		},
+		{
+			names: []string{"stack", "st"},
+			help:  "show the stack, top first",
+			run:   (*Debugger).cmdStack,
+		},
+		{
+			names: []string{"calls", "bt"},
+			help:  "show the call stack, innermost call first",
+			run:   (*Debugger).cmdCalls,
+		},
+		{
+			names: []string{"heap", "x"},
+			args:  "[address [count]]",
+			help:  "show heap cells, or all of them that are not zero",
+			run:   (*Debugger).cmdHeap,
+		},
+		{
+			names: []string{"quit", "q"},
+			help:  "stop debugging",
+			quit:  true,
+		},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commandList {
+		for _, n := range commandList[i].names {
+			if n == name {
+				return &commandList[i]
+			}
+		}
+	}
+	return nil
+}
+
+var errArgs = errors.New("wrong number of arguments, try \"help\"")
+
+func (d *Debugger) cmdHelp(args []string) error {
+	for _, c := range commandList {
+		usage := strings.Join(c.names, ", ")
+		if c.args != "" {
+			usage += " " + c.args
+		}
+		d.printf("  %s\n      %s\n", usage, c.help)
+	}
+	d.printf(
+		"Labels are written with S for space and T for tab, e.g. STTS.\n" +
+			"An empty line repeats the last command.\n",
+	)
+	return nil
+}
+
+func (d *Debugger) cmdStep(args []string) error {
+	n := int64(1)
+	switch len(args) {
+	case 0:
+	case 1:
+		var err error
+		if n, err = parseInt(args[0]); err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("invalid count: %v", n)
+		}
+	default:
+		return errArgs
+	}
+	return d.resume(func() bool {
+		n--
+		return n <= 0
+	})
+}
+
+func (d *Debugger) cmdNext(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	vm := d.vm
+	if vm.Halted() || vm.PC >= len(vm.Code) ||
+		vm.Code[vm.PC].Cmd != ast.CmdCall {
+		return d.cmdStep(nil)
+	}
+	depth := len(vm.RetTo)
+	return d.resume(func() bool {
+		return len(vm.RetTo) <= depth
+	})
+}
+
+func (d *Debugger) cmdFinish(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	depth := len(d.vm.RetTo)
+	if depth == 0 {
+		return errors.New("not inside a call")
+	}
+	return d.resume(func() bool {
+		return len(d.vm.RetTo) < depth
+	})
+}
+
+func (d *Debugger) cmdContinue(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	return d.resume(nil)
+}
+
+func (d *Debugger) cmdBreak(args []string) error {
+	pc, err := d.parseTarget(args)
+	if err != nil {
+		return err
+	}
+	d.breaks[pc] = true
+	d.printf("Breakpoint set at index %v:\n%s\n", pc, d.instr(pc))
+	return nil
+}
+
+// parseTarget parses the arguments of the break command, returning the
+// instruction index they refer to.
+func (d *Debugger) parseTarget(args []string) (int, error) {
+	code := d.vm.Code
+	switch {
+	case len(args) == 1:
+		pc, err := parseInt(args[0])
+		if err != nil {
+			return 0, err
+		}
+		if pc < 0 || pc >= int64(len(code)) {
+			return 0, fmt.Errorf("no instruction at index %v", pc)
+		}
+		return int(pc), nil
+	case len(args) == 2 && args[0] == "line":
+		line, err := parseInt(args[1])
+		if err != nil {
+			return 0, err
+		}
+		for pc, i := range code {
+			if int64(i.Pos.Line) >= line {
+				return pc, nil
+			}
+		}
+		return 0, fmt.Errorf("no instructions on or after line %v", line)
+	case len(args) == 2 && args[0] == "label":
+		label, err := asm.ParseLabelBits(args[1])
+		if err != nil {
+			return 0, err
+		}
+		pc, ok := d.vm.Labels[label]
+		if !ok {
+			return 0, fmt.Errorf("no such label: %v", args[1])
+		}
+		if pc >= len(code) {
+			return 0, fmt.Errorf(
+				"label %v is at the end of the code", args[1],
+			)
+		}
+		return pc, nil
+	}
+	return 0, errArgs
+}
+
+func (d *Debugger) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return errArgs
+	}
+	if args[0] == "all" {
+		d.breaks = map[int]bool{}
+		return nil
+	}
+	pc, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	if !d.breaks[int(pc)] {
+		return fmt.Errorf("no breakpoint at index %v", pc)
+	}
+	delete(d.breaks, int(pc))
+	return nil
+}
+
+func (d *Debugger) cmdWatch(args []string) error {
+	if len(args) != 1 {
+		return errArgs
+	}
+	adr, err := parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	d.watches[adr] = d.heapValue(adr)
+	d.printf("Watching heap[%v], currently %v.\n", adr, d.watches[adr])
+	return nil
+}
+
+func (d *Debugger) cmdUnwatch(args []string) error {
+	if len(args) != 1 {
+		return errArgs
+	}
+	if args[0] == "all" {
+		d.watches = map[int64]string{}
+		return nil
+	}
+	adr, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	if _, ok := d.watches[adr]; !ok {
+		return fmt.Errorf("no watchpoint on heap[%v]", adr)
+	}
+	delete(d.watches, adr)
+	return nil
+}
+
+func (d *Debugger) cmdInfo(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	if len(d.breaks) == 0 && len(d.watches) == 0 {
+		d.printf("No breakpoints or watchpoints.\n")
+		return nil
+	}
+	for pc := range d.vm.Code {
+		if d.breaks[pc] {
+			d.printf("Breakpoint at index %v:\n%s\n", pc, d.instr(pc))
+		}
+	}
+	for _, adr := range d.watched() {
+		d.printf(
+			"Watchpoint on heap[%v], currently %v.\n", adr, d.watches[adr],
+		)
+	}
+	return nil
+}
+
+func (d *Debugger) cmdWhere(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	d.where()
+	return nil
+}
+
+func (d *Debugger) cmdList(args []string) error {
+	from, count := int64(d.vm.PC-3), int64(10)
+	var err error
+	switch len(args) {
+	case 2:
+		if count, err = parseInt(args[1]); err != nil {
+			return err
+		}
+		fallthrough
+	case 1:
+		if from, err = parseInt(args[0]); err != nil {
+			return err
+		}
+	case 0:
+	default:
+		return errArgs
+	}
+	if from < 0 {
+		from = 0
+	}
+	to := from + count
+	if to > int64(len(d.vm.Code)) {
+		to = int64(len(d.vm.Code))
+	}
+	if from >= to {
+		return errors.New("no instructions in that range")
+	}
+	for pc := from; pc < to; pc++ {
+		d.printf("%s\n", d.instr(int(pc)))
+	}
+	return nil
+}
+
+func (d *Debugger) cmdStack(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	vs := d.stackValues()
+	if len(vs) == 0 {
+		d.printf("The stack is empty.\n")
+		return nil
+	}
+	for i := len(vs) - 1; i >= 0; i-- {
+		d.printf("%5d: %v\n", len(vs)-1-i, vs[i])
+	}
+	return nil
+}
+
+func (d *Debugger) cmdCalls(args []string) error {
+	if len(args) != 0 {
+		return errArgs
+	}
+	rets := d.vm.RetTo
+	if len(rets) == 0 {
+		d.printf("Not inside a call.\n")
+		return nil
+	}
+	for i := len(rets) - 1; i >= 0; i-- {
+		// The instruction before the return address is the call.
+		call := rets[i] - 1
+		d.printf(
+			"#%d return to index %v, from call at %v\n",
+			len(rets)-1-i, rets[i], d.vm.Code[call].Pos,
+		)
+	}
+	return nil
+}
+
+func (d *Debugger) cmdHeap(args []string) error {
+	var adr, count int64 = 0, 1
+	var err error
+	switch len(args) {
+	case 0:
+		return d.showHeap()
+	case 2:
+		if count, err = parseInt(args[1]); err != nil {
+			return err
+		}
+		fallthrough
+	case 1:
+		if adr, err = parseAddress(args[0]); err != nil {
+			return err
+		}
+	default:
+		return errArgs
+	}
+	for i := int64(0); i < count; i++ {
+		d.printf("heap[%v] = %v\n", adr+i, d.heapValue(adr+i))
+	}
+	return nil
+}
+
+// showHeap shows all the heap cells that are not zero.
+func (d *Debugger) showHeap() error {
+	var adrs []int64
+	if d.vm.BigInts() {
+		for adr, v := range d.vm.BigHeap {
+			if v.Sign() != 0 {
+				adrs = append(adrs, adr)
+			}
+		}
+	} else {
+		d.vm.Heap.Range(func(adr, v int64) {
+			if v != 0 {
+				adrs = append(adrs, adr)
+			}
+		})
+	}
+	sort.Slice(adrs, func(i, j int) bool { return adrs[i] < adrs[j] })
+	if len(adrs) == 0 {
+		d.printf("All heap cells are zero.\n")
+		return nil
+	}
+	for _, adr := range adrs {
+		d.printf("heap[%v] = %v\n", adr, d.heapValue(adr))
+	}
+	return nil
+}
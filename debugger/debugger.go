@@ -0,0 +1,252 @@
+// Package debugger implements an interactive command-line debugger for
+// programs running on an interp.VM.
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/edorfaus/whitespace/asm"
+	"github.com/edorfaus/whitespace/interp"
+)
+
+// Prompt is printed before reading each debugger command.
+const Prompt = "(wsdb) "
+
+type Debugger struct {
+	vm  *interp.VM
+	in  *bufio.Reader
+	out io.Writer
+
+	// breaks holds the instruction indexes that have breakpoints.
+	breaks map[int]bool
+	// watches holds the watched heap addresses and their last values.
+	watches map[int64]string
+	// labels holds the names of the labels that mark each instruction.
+	labels map[int][]string
+
+	// last is the last command that was given, which is repeated if an
+	// empty line is entered.
+	last []string
+}
+
+// New returns a debugger for the given VM, which reads commands from in
+// and writes its output to out.
+//
+// The VM should not have been run yet, and should not be run by anything
+// else while the debugger is using it.
+func New(vm *interp.VM, in io.Reader, out io.Writer) *Debugger {
+	br, ok := in.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(in)
+	}
+	d := &Debugger{
+		vm:      vm,
+		in:      br,
+		out:     out,
+		breaks:  map[int]bool{},
+		watches: map[int64]string{},
+		labels:  map[int][]string{},
+	}
+	for name, pc := range vm.Labels {
+		d.labels[pc] = append(d.labels[pc], name)
+	}
+	for _, names := range d.labels {
+		sort.Strings(names)
+	}
+	return d
+}
+
+// Run reads and executes debugger commands until the quit command is
+// given or the end of the input is reached.
+func (d *Debugger) Run() error {
+	d.printf("Whitespace debugger, type \"help\" for a list of commands.\n")
+	d.where()
+	for {
+		d.printf("%s", Prompt)
+		line, err := d.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				d.printf("\n")
+				return nil
+			}
+			return err
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			if d.last == nil {
+				continue
+			}
+			args = d.last
+		}
+		d.last = args
+
+		cmd := findCommand(args[0])
+		if cmd == nil {
+			d.printf("Unknown command %q, try \"help\".\n", args[0])
+			continue
+		}
+		if cmd.quit {
+			return nil
+		}
+		if err := cmd.run(d, args[1:]); err != nil {
+			d.printf("Error: %v\n", err)
+		}
+	}
+}
+
+func (d *Debugger) printf(format string, args ...interface{}) {
+	fmt.Fprintf(d.out, format, args...)
+}
+
+// resume executes instructions until the program halts, a breakpoint or
+// watchpoint is hit, or stop (if not nil) returns true after executing
+// an instruction. A breakpoint on the current instruction is ignored,
+// since execution has already stopped there.
+func (d *Debugger) resume(stop func() bool) error {
+	if d.vm.Halted() {
+		return errHalted
+	}
+	for first := true; !d.vm.Halted(); first = false {
+		if !first && d.breaks[d.vm.PC] {
+			d.printf("Breakpoint at index %v.\n", d.vm.PC)
+			break
+		}
+		d.vm.Step()
+		if d.checkWatches() || (stop != nil && stop()) {
+			break
+		}
+	}
+	d.where()
+	return nil
+}
+
+var errHalted = errors.New("the program is not running")
+
+// checkWatches reports any watched heap cells whose value has changed,
+// returning true if there were any.
+func (d *Debugger) checkWatches() bool {
+	changed := false
+	for _, adr := range d.watched() {
+		old, v := d.watches[adr], d.heapValue(adr)
+		if v != old {
+			d.printf(
+				"Watchpoint: heap[%v] changed from %v to %v.\n", adr, old, v,
+			)
+			d.watches[adr] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// watched returns the watched heap addresses in order.
+func (d *Debugger) watched() []int64 {
+	adrs := make([]int64, 0, len(d.watches))
+	for adr := range d.watches {
+		adrs = append(adrs, adr)
+	}
+	sort.Slice(adrs, func(i, j int) bool { return adrs[i] < adrs[j] })
+	return adrs
+}
+
+// heapValue returns the value of the given heap cell, as text.
+func (d *Debugger) heapValue(adr int64) string {
+	if d.vm.BigInts() {
+		if v, ok := d.vm.BigHeap[adr]; ok {
+			return v.String()
+		}
+		return "0"
+	}
+	return strconv.FormatInt(d.vm.Heap.Load(adr), 10)
+}
+
+// where shows the current state of the program.
+func (d *Debugger) where() {
+	vm := d.vm
+	switch {
+	case vm.Err != nil:
+		d.printf("The program failed: %v\n", vm.Err)
+	case vm.Exited():
+		d.printf("The program exited.\n")
+	case vm.PC >= len(vm.Code):
+		d.printf("The program ended without exiting.\n")
+	default:
+		d.printf("%s\n", d.instr(vm.PC))
+	}
+}
+
+// instr describes the instruction at the given index.
+func (d *Debugger) instr(pc int) string {
+	var sb strings.Builder
+	for _, name := range d.labels[pc] {
+		fmt.Fprintf(&sb, "label %s:\n", asm.LabelBits(name))
+	}
+	mark := " "
+	if pc == d.vm.PC && !d.vm.Halted() {
+		mark = ">"
+	}
+	if d.breaks[pc] {
+		mark += "*"
+	} else {
+		mark += " "
+	}
+	if pc >= len(d.vm.Code) {
+		fmt.Fprintf(&sb, "%s%5d past the end of the program", mark, pc)
+		return sb.String()
+	}
+	i := d.vm.Code[pc]
+	fmt.Fprintf(&sb, "%s%5d %-22v %v", mark, pc, i.Pos, i.Cmd)
+	switch arg := d.vm.InstrArg(pc).(type) {
+	case nil:
+	case int:
+		// The target of a call or jump
+		fmt.Fprintf(&sb, " %v", arg)
+		if names := d.labels[arg]; len(names) > 0 {
+			fmt.Fprintf(&sb, " (%s)", asm.LabelBits(names[0]))
+		}
+	default:
+		fmt.Fprintf(&sb, " %v", arg)
+	}
+	return sb.String()
+}
+
+// stackValues returns the values on the stack, as text, bottom first.
+func (d *Debugger) stackValues() []string {
+	var vs []string
+	if d.vm.BigInts() {
+		for _, v := range d.vm.BigStack {
+			vs = append(vs, v.String())
+		}
+		return vs
+	}
+	for _, v := range d.vm.Stack {
+		vs = append(vs, strconv.FormatInt(v, 10))
+	}
+	return vs
+}
+
+// parseAddress parses a heap address argument, which must not be
+// negative.
+func parseAddress(s string) (int64, error) {
+	adr, err := parseInt(s)
+	if err == nil && adr < 0 {
+		err = fmt.Errorf("invalid heap address: %v", adr)
+	}
+	return adr, err
+}
+
+// parseInt parses a number argument, which must fit in an int64.
+func parseInt(s string) (int64, error) {
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %q", s)
+	}
+	return v, nil
+}
@@ -1,385 +1,380 @@
-// This version of the code is designed to not load the entire program
-// into memory, but instead interpret it directly from the source file.
+// Package direct implements a Whitespace interpreter that is designed
+// to not load the entire program into memory, but instead interpret it
+// directly from the source.
 //
 // That enables it to handle both much larger programs (larger than the
 // available memory), and programs that have trailing garbage.
 //
 // However, that also makes it slower for most reasonable programs, as
-// it has to read the file several times to handle loops and such.
-// (Also, the current implementation has horrible file handling,
-// reading the bytes one at a time without doing any buffering.)
+// it has to re-read parts of the source to handle loops and such.
 //
 // Memory is still used to keep the target locations of any labels it
-// has seen, to avoid having to re-scan the file on every jump or call,
-// so a program with a lot of labels can still be a problem.
-
-package main
+// has seen, to avoid having to re-scan the source on every jump or
+// call, so a program with a lot of labels can still be a problem.
+package direct
 
 import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
+
+	"github.com/edorfaus/whitespace/ast"
+	"github.com/edorfaus/whitespace/interp"
+	"github.com/edorfaus/whitespace/parser"
 )
 
-var Err error
+// Machine runs a Whitespace program directly from its source.
+type Machine struct {
+	// Err is the error that stopped the program, if any.
+	Err error
+
+	src *source
+	dec *parser.Decoder
+	io  *interp.IO
+
+	stack, callStack []int64
+	heap             map[int64]int64
+
+	labels map[string]int64
+
+	// floorDiv makes div and mod round toward negative infinity instead
+	// of toward zero, like the reference implementation does.
+	floorDiv bool
+
+	// eofPolicy is what to do when reading at the end of the input, and
+	// eofValue is the value to store for interp.EOFValue.
+	eofPolicy interp.EOFPolicy
+	eofValue  int64
+
+	// instrPos is the offset of the first byte of the current instruction.
+	instrPos int64
+}
+
+// Option is an option that changes how a Machine works.
+type Option func(*Machine)
+
+// WithIO makes the machine use the given IO for all its I/O. The default
+// is to use an IO that reads from os.Stdin and writes to os.Stdout.
+func WithIO(c *interp.IO) Option {
+	return func(m *Machine) {
+		m.io = c
+	}
+}
 
-var s *source
+// WithDivision selects how the div and mod instructions round the
+// result. The default is interp.DivTruncate.
+func WithDivision(d interp.Division) Option {
+	return func(m *Machine) {
+		m.floorDiv = d == interp.DivFloor
+	}
+}
 
-var stack, callStack []int64
-var heap = map[int64]int64{}
+// WithEOF sets the policy for what happens at the end of the input, and
+// the value to store for the interp.EOFValue policy. The default is
+// interp.EOFError.
+func WithEOF(p interp.EOFPolicy, value int64) Option {
+	return func(m *Machine) {
+		m.eofPolicy = p
+		m.eofValue = value
+	}
+}
+
+// New returns a machine that runs the program read from r, starting at
+// its current position.
+func New(r io.ReadSeeker, opts ...Option) *Machine {
+	m := &Machine{
+		heap:   map[int64]int64{},
+		labels: map[string]int64{},
+	}
+	m.src, m.Err = newSource(r)
+	m.dec = parser.NewDecoder(m.src)
+	if off := m.src.Pos(); off != 0 {
+		// The line and column are not known when not at the start.
+		m.dec.Reset(m.src, ast.Pos{Offset: off})
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.io == nil {
+		m.io = interp.NewIO(os.Stdin, os.Stdout)
+	}
+	return m
+}
 
-var labels = map[string]int64{}
+// Run runs the program until it exits or fails, and returns the error
+// that stopped it, if any.
+func (m *Machine) Run() error {
+	m.runSource()
+	m.setErr(m.io.Flush())
+	return m.Err
+}
 
-func runSource() {
-	for Err == nil {
-		a, b := s.Next(), s.Next()
-		if a == ' ' && b == ' ' {
-			// Stack Manipulation: Push
-			push(readNumber())
-			continue
+func (m *Machine) runSource() {
+	for m.Err == nil {
+		c, err := m.dec.Next()
+		if err == io.EOF {
+			m.instrPos = m.pos()
+			m.failAt("program ended without exit")
+			return
 		}
-		c := s.Next()
-		is := func(A, B, C byte) bool {
-			return a == A && b == B && c == C
+		if m.setErr(err) {
+			return
 		}
-		switch {
-		// Stack Manipulation
-		case is(' ', '\n', ' '): // Duplicate
-			push(stack[len(stack)-1])
-		case is(' ', '\t', ' '): // Copy
-			n := readNumber()
-			push(stack[int64(len(stack))-1-n])
-		case is(' ', '\n', '\t'): // Swap
-			a, b := pop(), pop()
-			push(a)
-			push(b)
-		case is(' ', '\n', '\n'): // Discard
-			pop()
-		case is(' ', '\t', '\n'): // Slide
-			n := readNumber()
-			v := pop()
-			for ; n > 0; n-- {
-				pop()
-			}
-			push(v)
-		// Arithmetic
-		case is('\t', ' ', ' '):
-			b, a := pop(), pop()
-			switch s.Next() {
-			case ' ': // Add
-				push(a + b)
-			case '\t': // Subtract
-				push(a - b)
-			case '\n': // Multiply
-				push(a * b)
-			}
-		case is('\t', ' ', '\t'):
-			switch s.Next() {
-			case ' ': // Division
-				d := pop()
-				push(pop() / d)
-			case '\t': // Modulo
-				d := pop()
-				push(pop() % d)
-			case '\n': // Undefined
-				fail("unknown instruction: TSTL")
-			}
-		// Heap Access
-		case is('\t', '\t', ' '): // Store
-			val, adr := pop(), pop()
-			heap[adr] = val
-		case is('\t', '\t', '\t'): // Retrieve
-			push(heap[pop()])
-		// Flow Control
-		case is('\n', ' ', ' '): // Mark
-			l := readLabel()
-			labels[l] = s.Pos()
-		case is('\n', ' ', '\t'): // Call
-			l := readLabel()
-			callStack = append(callStack, s.Pos())
-			jump(l)
-		case is('\n', ' ', '\n'): // Jump
-			jump(readLabel())
-		case is('\n', '\t', ' '): // Jump if zero
-			l := readLabel()
-			if pop() == 0 {
-				jump(l)
-			}
-		case is('\n', '\t', '\t'): // Jump if negative
-			l := readLabel()
-			if pop() < 0 {
-				jump(l)
-			}
-		case is('\n', '\t', '\n'): // Return
-			v := callStack[len(callStack)-1]
-			callStack = callStack[:len(callStack)-1]
-			s.Seek(v)
-		case is('\n', '\n', '\n'): // End
+		m.instrPos = c.Pos.Offset
+		if c.Cmd == ast.CmdExit {
 			return
-		// I/O
-		case is('\t', '\n', ' '):
-			switch s.Next() {
-			case ' ': // Output character
-				_, err := fmt.Printf("%c", pop())
-				setErr(err)
-			case '\t': // Output number
-				_, err := fmt.Printf("%d", pop())
-				setErr(err)
-			case '\n': // Undefined
-				fail("unknown instruction: TLSL")
-			}
-		case is('\t', '\n', '\t'):
-			var v int64
-			switch s.Next() {
-			case ' ': // Read character
-				_, err := fmt.Scanf("%c", &v)
-				setErr(err)
-				heap[pop()] = v
-			case '\t': // Read number
-				_, err := fmt.Scanf("%d\n", &v)
-				setErr(err)
-				heap[pop()] = v
-			case '\n': // Undefined
-				fail("unknown instruction: TLTL")
-			}
-		default:
-			fail("unknown instruction: %q %q %q", a, b, c)
 		}
+		m.exec(c)
 	}
 }
 
-func jump(label string) {
-	if pos, ok := labels[label]; ok {
-		s.Seek(pos)
-		return
-	}
-	for Err == nil {
-		a, b := s.Next(), s.Next()
-		if a == ' ' && b == ' ' {
-			// Stack Manipulation: Push
-			readNumber()
-			continue
+// exec executes a command, other than exit.
+func (m *Machine) exec(c ast.Command) {
+	n, _ := c.Arg.(int64)
+	l, _ := c.Arg.(string)
+	switch c.Cmd {
+	// Stack Manipulation
+	case ast.CmdPush:
+		m.push(n)
+	case ast.CmdDup:
+		if m.stackSize(1) {
+			m.push(m.stack[len(m.stack)-1])
 		}
-		c := s.Next()
-		is := func(A, B, C byte) bool {
-			return a == A && b == B && c == C
+	case ast.CmdCopy:
+		if n < 0 || n >= int64(len(m.stack)) {
+			m.failAt("copy index out of range: %v", n)
+			break
 		}
-		switch {
-		// Stack Manipulation
-		case is(' ', '\n', ' '): // Duplicate
-		case is(' ', '\t', ' '): // Copy
-			readNumber()
-		case is(' ', '\n', '\t'): // Swap
-		case is(' ', '\n', '\n'): // Discard
-		case is(' ', '\t', '\n'): // Slide
-			readNumber()
-		// Arithmetic
-		case is('\t', ' ', ' '): // Add, Subtract, Multiply
-			s.Next()
-		case is('\t', ' ', '\t'):
-			switch s.Next() {
-			case ' ': // Division
-			case '\t': // Modulo
-			case '\n': // Undefined
-				fail("unknown instruction: TSTL")
-			}
-		// Heap Access
-		case is('\t', '\t', ' '): // Store
-		case is('\t', '\t', '\t'): // Retrieve
-		// Flow Control
-		case is('\n', ' ', ' '): // Mark
-			l := readLabel()
-			labels[l] = s.Pos()
-			if l == label {
-				return
-			}
-		case is('\n', ' ', '\t'): // Call
-			readLabel()
-		case is('\n', ' ', '\n'): // Jump
-			readLabel()
-		case is('\n', '\t', ' '): // Jump if zero
-			readLabel()
-		case is('\n', '\t', '\t'): // Jump if negative
-			readLabel()
-		case is('\n', '\t', '\n'): // Return
-		case is('\n', '\n', '\n'): // End
-		// I/O
-		case is('\t', '\n', ' '):
-			switch s.Next() {
-			case ' ': // Output character
-			case '\t': // Output number
-			case '\n': // Undefined
-				fail("unknown instruction: TLSL")
-			}
-		case is('\t', '\n', '\t'):
-			switch s.Next() {
-			case ' ': // Read character
-			case '\t': // Read number
-			case '\n': // Undefined
-				fail("unknown instruction: TLTL")
-			}
-		default:
-			fail("unknown instruction: %q %q %q", a, b, c)
+		m.push(m.stack[int64(len(m.stack))-1-n])
+	case ast.CmdSwap:
+		if m.stackSize(2) {
+			a, b := m.pop(), m.pop()
+			m.push(a)
+			m.push(b)
+		}
+	case ast.CmdDiscard:
+		if m.stackSize(1) {
+			m.pop()
+		}
+	case ast.CmdSlide:
+		if n < 0 || n >= int64(len(m.stack)) {
+			m.failAt("slide count out of range: %v", n)
+			break
+		}
+		v := m.pop()
+		m.stack = m.stack[:int64(len(m.stack))-n]
+		m.push(v)
+	// Arithmetic
+	case ast.CmdAdd, ast.CmdSub, ast.CmdMul:
+		if !m.stackSize(2) {
+			break
+		}
+		b, a := m.pop(), m.pop()
+		switch c.Cmd {
+		case ast.CmdAdd:
+			m.push(a + b)
+		case ast.CmdSub:
+			m.push(a - b)
+		case ast.CmdMul:
+			m.push(a * b)
+		}
+	case ast.CmdDiv:
+		if !m.stackSize(2) {
+			break
 		}
+		d := m.pop()
+		if d == 0 {
+			m.divisionByZero()
+			break
+		}
+		n := m.pop()
+		q := n / d
+		if m.floorDiv && n%d != 0 && (n < 0) != (d < 0) {
+			q--
+		}
+		m.push(q)
+	case ast.CmdMod:
+		if !m.stackSize(2) {
+			break
+		}
+		d := m.pop()
+		if d == 0 {
+			m.divisionByZero()
+			break
+		}
+		r := m.pop() % d
+		if m.floorDiv && r != 0 && (r < 0) != (d < 0) {
+			r += d
+		}
+		m.push(r)
+	// Heap Access
+	case ast.CmdStore:
+		if m.stackSize(2) {
+			val, adr := m.pop(), m.pop()
+			m.heap[adr] = val
+		}
+	case ast.CmdRetrieve:
+		if m.stackSize(1) {
+			m.push(m.heap[m.pop()])
+		}
+	// Flow Control
+	case ast.CmdMark:
+		m.mark(l)
+	case ast.CmdCall:
+		m.callStack = append(m.callStack, m.pos())
+		m.jump(l)
+	case ast.CmdJump:
+		m.jump(l)
+	case ast.CmdJumpIfZero:
+		if m.stackSize(1) && m.pop() == 0 {
+			m.jump(l)
+		}
+	case ast.CmdJumpIfNeg:
+		if m.stackSize(1) && m.pop() < 0 {
+			m.jump(l)
+		}
+	case ast.CmdReturn:
+		if len(m.callStack) == 0 {
+			m.failAt("return with empty call stack")
+			break
+		}
+		v := m.callStack[len(m.callStack)-1]
+		m.callStack = m.callStack[:len(m.callStack)-1]
+		m.seekTo(v)
+	// I/O
+	case ast.CmdOutChar:
+		if m.stackSize(1) {
+			m.setErr(m.io.WriteChar(m.pop()))
+		}
+	case ast.CmdOutNumber:
+		if m.stackSize(1) {
+			m.setErr(m.io.WriteNumber(m.pop()))
+		}
+	case ast.CmdReadChar:
+		if m.stackSize(1) {
+			v, err := m.io.ReadChar()
+			m.storeRead(int64(v), err)
+		}
+	case ast.CmdReadNumber:
+		if m.stackSize(1) {
+			v, err := m.io.ReadNumber()
+			m.storeRead(v, err)
+		}
+	default:
+		m.failAt("unknown instruction: %v", c.Cmd)
 	}
 }
 
-func readNumber() int64 {
-	neg := false
-	b := s.Next()
-	if Err != nil {
-		return 0
+func (m *Machine) jump(label string) {
+	if pos, ok := m.labels[label]; ok {
+		m.seekTo(pos)
+		return
 	}
-	switch b {
-	case ' ':
-		// Positive
-	case '\t':
-		neg = true
-	default:
-		fail("expected sign for number, got %q", b)
-		return 0
+	if !m.scan(func(l string) bool { return l == label }) {
+		m.failAt("undefined label: %q", label)
 	}
+}
 
-	var value int64
-	for {
-		b := s.Next()
-		if Err != nil {
-			return 0
+// scan skips commands, recording the labels it sees, until found returns
+// true for a label, in which case it returns true. Otherwise it returns
+// false at the end of the source, or if an error occurs.
+func (m *Machine) scan(found func(label string) bool) bool {
+	for m.Err == nil {
+		c, err := m.dec.Next()
+		if err == io.EOF || m.setErr(err) {
+			return false
 		}
-		switch b {
-		case ' ':
-			value <<= 1
-		case '\t':
-			value = (value << 1) | 1
-		case '\n':
-			if neg {
-				return -value
+		if c.Cmd == ast.CmdMark {
+			l := c.Arg.(string)
+			m.mark(l)
+			if found(l) {
+				return true
 			}
-			return value
-		}
-		if value < 0 {
-			fail("read a number too large for this implementation")
-			return 0
 		}
 	}
+	return false
 }
 
-func readLabel() string {
-	var sb strings.Builder
-	for {
-		b := s.Next()
-		switch b {
-		case ' ', '\t':
-			sb.WriteByte(b)
-		case '\n':
-			return sb.String()
-		default:
-			fail("unexpected byte during label: %q", b)
-			return ""
-		}
+// mark records that a label is defined at the current position, unless
+// it has already been defined, since the first definition of a label is
+// the one that jumps go to.
+func (m *Machine) mark(label string) {
+	if _, ok := m.labels[label]; !ok {
+		m.labels[label] = m.pos()
 	}
 }
 
-func push(v int64) {
-	stack = append(stack, v)
+// storeRead stores a value that was read from the input at the heap
+// address on the stack, handling the end of the input as configured.
+func (m *Machine) storeRead(v int64, err error) {
+	adr := m.pop()
+	if err == io.EOF && m.eofPolicy != interp.EOFError {
+		if m.eofPolicy == interp.EOFUnchanged {
+			return
+		}
+		v, err = m.eofValue, nil
+	}
+	if !m.setErr(err) {
+		m.heap[adr] = v
+	}
 }
 
-func pop() int64 {
-	v := stack[len(stack)-1]
-	stack = stack[:len(stack)-1]
-	return v
+func (m *Machine) divisionByZero() {
+	m.failAt("division by zero")
 }
 
-type source struct {
-	file *os.File
+// stackSize checks that the stack holds at least n values, failing with
+// a stack underflow error if it does not.
+func (m *Machine) stackSize(n int64) bool {
+	if int64(len(m.stack)) < n {
+		m.failAt("stack underflow")
+	}
+	return m.Err == nil
 }
 
-func (s *source) Next() byte {
-	if Err != nil {
-		return 0
-	}
-	var buf [1]byte
-	times := 0
-	for {
-		n, err := s.file.Read(buf[:])
-		if setErr(err) {
-			return 0
-		}
-		if n < 1 {
-			times++
-			if times >= 64 {
-				setErr(io.ErrNoProgress)
-				return 0
-			}
-		}
-		times = 0
-		switch buf[0] {
-		case ' ', '\t', '\n':
-			return buf[0]
-		}
-	}
+func (m *Machine) push(v int64) {
+	m.stack = append(m.stack, v)
 }
 
-func (s *source) Pos() int64 {
-	if Err != nil {
-		return -1
-	}
-	pos, err := s.file.Seek(0, io.SeekCurrent)
-	setErr(err)
-	return pos
+func (m *Machine) pop() int64 {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
 }
 
-func (s *source) Seek(pos int64) {
-	if Err != nil {
-		return
-	}
-	p, err := s.file.Seek(pos, io.SeekStart)
-	setErr(err)
-	if p != pos {
-		fail("seek failed, %v != %v", p, pos)
+// pos returns the offset of the next byte to be read from the source.
+func (m *Machine) pos() int64 {
+	if m.Err != nil {
+		return -1
 	}
+	return m.dec.Pos().Offset
 }
 
-func run() {
-	if Err != nil {
+// seekTo makes execution continue at the given offset in the source.
+func (m *Machine) seekTo(pos int64) {
+	if m.Err != nil {
 		return
 	}
-	var file *os.File
-	if len(os.Args) > 1 {
-		file, Err = os.Open(os.Args[1])
-	} else {
-		file, Err = os.Open("hello-world.ws")
+	if !m.setErr(m.src.SeekTo(pos)) {
+		m.dec.Reset(m.src, ast.Pos{Offset: pos})
 	}
-	if Err != nil {
-		return
-	}
-	defer func() { setErr(file.Close()) }()
-
-	s = &source{
-		file: file,
-	}
-
-	runSource()
 }
 
-func fail(format string, args ...interface{}) {
-	if Err == nil {
-		Err = fmt.Errorf(format, args...)
+func (m *Machine) fail(format string, args ...interface{}) {
+	if m.Err == nil {
+		m.Err = fmt.Errorf(format, args...)
 	}
 }
 
-func setErr(err error) bool {
-	if Err == nil {
-		Err = err
-	}
-	return Err != nil
+// failAt fails with an error that includes the offset of the current
+// instruction.
+func (m *Machine) failAt(format string, args ...interface{}) {
+	m.fail(format+" at offset %v", append(args, m.instrPos)...)
 }
 
-func main() {
-	run()
-	if Err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", Err)
-		os.Exit(1)
+func (m *Machine) setErr(err error) bool {
+	if m.Err == nil {
+		m.Err = err
 	}
+	return m.Err != nil
 }
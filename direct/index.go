@@ -0,0 +1,201 @@
+package direct
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edorfaus/whitespace/asm"
+)
+
+// indexHeader is the first line of an index file, identifying its format.
+const indexHeader = "whitespace label index v2"
+
+// Index holds the offset of every label in a program, so that a Machine
+// can jump to a label it has not seen yet without scanning for it.
+//
+// It also holds a hash of the program's source, to be able to tell if
+// the index is out of date, and the size and modification time of the
+// file, to be able to tell that quickly.
+type Index struct {
+	// Hash is the SHA-256 hash of the whole source of the program.
+	Hash [sha256.Size]byte
+	// Size is the size of the source, and ModTime is the modification
+	// time of the file it was read from (which is zero if not known).
+	Size    int64
+	ModTime time.Time
+	// Labels maps each label to the offset just after its first
+	// definition, which is where execution continues when jumping to it.
+	Labels map[string]int64
+}
+
+// WithIndex makes the machine start out knowing the labels in the given
+// index. The index must be valid for the program being run.
+func WithIndex(x *Index) Option {
+	return func(m *Machine) {
+		for l, pos := range x.Labels {
+			m.labels[l] = pos
+		}
+	}
+}
+
+// BuildIndex reads the whole source of a program from r, and returns an
+// index of its labels. If r is a file (it has a Stat method, like an
+// *os.File), the index also gets the file's modification time.
+func BuildIndex(r io.ReadSeeker) (*Index, error) {
+	x := &Index{}
+	if f, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		x.ModTime = fi.ModTime()
+	}
+
+	var err error
+	if x.Size, err = r.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	if x.Hash, err = HashSource(r); err != nil {
+		return nil, err
+	}
+
+	m := New(r)
+	if m.scan(func(string) bool { return false }); m.Err != nil {
+		return nil, m.Err
+	}
+	x.Labels = m.labels
+	return x, nil
+}
+
+// HashSource returns the SHA-256 hash of the whole source read from r,
+// and then seeks back to the start of it.
+func HashSource(r io.ReadSeeker) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return hash, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return hash, err
+	}
+	copy(hash[:], h.Sum(nil))
+	_, err := r.Seek(0, io.SeekStart)
+	return hash, err
+}
+
+// Valid returns true if the index is for the source read from r, which
+// it checks by hashing the source. It then seeks back to the start.
+func (x *Index) Valid(r io.ReadSeeker) (bool, error) {
+	hash, err := HashSource(r)
+	return hash == x.Hash, err
+}
+
+// Matches returns true if the index was made for a file with the size
+// and modification time given by fi. That is much faster than Valid,
+// since it does not read the file, but can be fooled by a change that
+// keeps the size and restores the modification time.
+func (x *Index) Matches(fi os.FileInfo) bool {
+	return !x.ModTime.IsZero() && fi.Size() == x.Size &&
+		fi.ModTime().Equal(x.ModTime)
+}
+
+// WriteTo writes the index to w in a line-based text format, with one
+// label per line, written as its offset and its bits (as returned by
+// asm.LabelBits).
+func (x *Index) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, indexHeader)
+	fmt.Fprintln(&buf, "sha256", hex.EncodeToString(x.Hash[:]))
+	mtime := int64(0)
+	if !x.ModTime.IsZero() {
+		mtime = x.ModTime.UnixNano()
+	}
+	fmt.Fprintln(&buf, "file", x.Size, mtime)
+
+	labels := make([]string, 0, len(x.Labels))
+	for l := range x.Labels {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return x.Labels[labels[i]] < x.Labels[labels[j]]
+	})
+	for _, l := range labels {
+		fmt.Fprintln(&buf, x.Labels[l], asm.LabelBits(l))
+	}
+
+	return buf.WriteTo(w)
+}
+
+// ReadIndex reads an index that was written by Index.WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	x := &Index{Labels: map[string]int64{}}
+	src := bufio.NewScanner(r)
+	line := 0
+	bad := func(msg string) error {
+		return fmt.Errorf("invalid label index, line %v: %v", line, msg)
+	}
+	for src.Scan() {
+		line++
+		fields := strings.Fields(src.Text())
+		switch {
+		case line == 1:
+			if src.Text() != indexHeader {
+				return nil, bad("unknown format")
+			}
+		case line == 2:
+			if len(fields) != 2 || fields[0] != "sha256" {
+				return nil, bad("expected hash")
+			}
+			hash, err := hex.DecodeString(fields[1])
+			if err != nil || len(hash) != sha256.Size {
+				return nil, bad("invalid hash")
+			}
+			copy(x.Hash[:], hash)
+		case line == 3:
+			if len(fields) != 3 || fields[0] != "file" {
+				return nil, bad("expected file size and time")
+			}
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, bad("invalid file size")
+			}
+			mtime, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, bad("invalid file time")
+			}
+			x.Size = size
+			if mtime != 0 {
+				x.ModTime = time.Unix(0, mtime)
+			}
+		default:
+			if len(fields) != 2 {
+				return nil, bad("expected offset and label")
+			}
+			pos, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil || pos < 0 {
+				return nil, bad("invalid offset")
+			}
+			l, err := asm.ParseLabelBits(fields[1])
+			if err != nil {
+				return nil, bad(err.Error())
+			}
+			x.Labels[l] = pos
+		}
+	}
+	if err := src.Err(); err != nil {
+		return nil, err
+	}
+	if line < 3 {
+		return nil, bad("unexpected end of file")
+	}
+	return x, nil
+}
@@ -0,0 +1,106 @@
+package direct
+
+import (
+	"fmt"
+	"io"
+)
+
+// bufferSize is the size of the buffer a source reads into.
+const bufferSize = 64 * 1024
+
+// source reads the bytes of a program from an io.ReadSeeker, with
+// buffering, while keeping track of the offset of each byte.
+//
+// It implements io.ByteReader, which is what the decoder reads from.
+//
+// Seeking to an offset that is in the buffer does not seek the
+// underlying reader, so short loops do not have to re-read the source.
+type source struct {
+	r io.ReadSeeker
+
+	// buf holds the bytes that were last read, with i being the index of
+	// the next byte to return, and off the offset of buf[0] in the source.
+	buf []byte
+	i   int
+	off int64
+
+	// err is an error returned by the reader along with the bytes that
+	// are in buf, to be returned once those bytes have been used.
+	err error
+}
+
+func newSource(r io.ReadSeeker) (*source, error) {
+	off, err := r.Seek(0, io.SeekCurrent)
+	return &source{
+		r:   r,
+		buf: make([]byte, 0, bufferSize),
+		off: off,
+	}, err
+}
+
+// ReadByte returns the next byte from the source.
+func (s *source) ReadByte() (byte, error) {
+	for s.i >= len(s.buf) {
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b := s.buf[s.i]
+	s.i++
+	return b, nil
+}
+
+func (s *source) Read(p []byte) (int, error) {
+	for s.i >= len(s.buf) {
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf[s.i:])
+	s.i += n
+	return n, nil
+}
+
+// fill replaces the contents of the buffer with the next bytes from the
+// source.
+func (s *source) fill() error {
+	s.off += int64(len(s.buf))
+	s.buf, s.i = s.buf[:0], 0
+	if s.err != nil {
+		return s.err
+	}
+	for times := 0; times < 64; times++ {
+		n, err := s.r.Read(s.buf[:cap(s.buf)])
+		s.buf = s.buf[:n]
+		if n > 0 {
+			s.err = err
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return io.ErrNoProgress
+}
+
+// Pos returns the offset of the next byte to be read.
+func (s *source) Pos() int64 {
+	return s.off + int64(s.i)
+}
+
+// SeekTo makes the next byte to be read be the one at the given offset.
+func (s *source) SeekTo(pos int64) error {
+	if pos >= s.off && pos <= s.off+int64(len(s.buf)) {
+		s.i = int(pos - s.off)
+		return nil
+	}
+	p, err := s.r.Seek(pos, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	if p != pos {
+		return fmt.Errorf("seek failed, %v != %v", p, pos)
+	}
+	s.off, s.buf, s.i, s.err = p, s.buf[:0], 0, nil
+	return nil
+}
@@ -0,0 +1,111 @@
+package direct
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Spool makes a reader that cannot seek (like a pipe) seekable, by
+// copying everything that is read from it to a temporary file, which
+// is then read from instead when seeking back to data that has already
+// been read. This lets a Machine run a program that is being streamed
+// to it, while still being able to handle backward jumps.
+//
+// Seeking forward past the data that has been read so far reads and
+// copies the data up to there. Seeking relative to the end is not
+// supported, since the end is not known until it has been reached.
+type Spool struct {
+	r    io.Reader
+	file *os.File
+
+	// size is the number of bytes that have been copied to the file, and
+	// pos is the current position.
+	size, pos int64
+
+	// err is the error that was returned by r, if any.
+	err error
+}
+
+// NewSpool returns a Spool that reads from r, copying the data to a new
+// temporary file in the given directory (or the default directory for
+// temporary files if dir is empty).
+//
+// The temporary file is removed by Close.
+func NewSpool(r io.Reader, dir string) (*Spool, error) {
+	file, err := ioutil.TempFile(dir, "whitespace-spool-")
+	if err != nil {
+		return nil, err
+	}
+	return &Spool{r: r, file: file}, nil
+}
+
+func (s *Spool) Read(p []byte) (int, error) {
+	if s.pos > s.size {
+		if err := s.spool(s.pos - s.size); err != nil {
+			return 0, err
+		}
+	}
+	if s.pos < s.size {
+		if int64(len(p)) > s.size-s.pos {
+			p = p[:s.size-s.pos]
+		}
+		n, err := s.file.ReadAt(p, s.pos)
+		s.pos += int64(n)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	n, err := s.r.Read(p)
+	if n > 0 {
+		if _, werr := s.file.WriteAt(p[:n], s.size); werr != nil {
+			return 0, werr
+		}
+		s.size += int64(n)
+		s.pos += int64(n)
+	}
+	s.err = err
+	return n, err
+}
+
+// spool reads and copies n more bytes from the reader.
+func (s *Spool) spool(n int64) error {
+	pos := s.pos
+	s.pos = s.size
+	_, err := io.CopyN(ioutil.Discard, s, n)
+	s.pos = pos
+	return err
+}
+
+func (s *Spool) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		return s.pos, errors.New("spool: cannot seek relative to the end")
+	default:
+		return s.pos, errors.New("spool: invalid whence")
+	}
+	if offset < 0 {
+		return s.pos, errors.New("spool: negative position")
+	}
+	s.pos = offset
+	return s.pos, nil
+}
+
+// Close closes and removes the temporary file. It does not close the
+// reader the data is read from.
+func (s *Spool) Close() error {
+	err := s.file.Close()
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/edorfaus/whitespace/asm"
+)
+
+// disasmProgram writes an assembly listing of the program in the given
+// file to stdout.
+func disasmProgram(fn string) error {
+	p, err := parseFile(fn)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if err := asm.Disassemble(w, p.Commands); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/edorfaus/whitespace/interp"
+)
+
+var allErrors = flag.Bool(
+	"all-errors", false,
+	"report all syntax errors instead of stopping at the first one",
+)
+
+var bigInts = flag.Bool(
+	"big", false, "use big integers, without any limit on their size",
+)
+
+var checked = flag.Bool(
+	"checked", false, "fail on integer overflow instead of wrapping around",
+)
+
+var division = flag.String(
+	"div", "trunc",
+	"rounding of div and mod: trunc (toward zero) or floor (like Haskell)",
+)
+
+var timeout = flag.Duration(
+	"timeout", 0, "stop the program if it runs for longer than this",
+)
+
+var maxInstructions = flag.Int64(
+	"max-instructions", 0,
+	"stop the program if it executes more than this many instructions",
+)
+
+var heapKind = flag.String(
+	"heap", "auto", "heap implementation: auto, dense, sparse or paged",
+)
+
+var encoding = flag.String(
+	"encoding", "utf8",
+	"character encoding of input and output: utf8 or latin1",
+)
+
+var replace = flag.Bool(
+	"replace", false,
+	"replace invalid characters (with U+FFFD or '?') instead of failing",
+)
+
+var prefixes = flag.Bool(
+	"prefixes", false,
+	"allow number input in hex, octal or binary, with 0x, 0o or 0b prefix",
+)
+
+var eof = flag.String(
+	"eof", "error",
+	"what readc and readn do at end of input: error, unchanged (leave"+
+		" the heap unchanged), or a number to store (usually -1 or 0)",
+)
+
+var trace = flag.Bool(
+	"trace", false, "write a trace of the executed instructions to stderr",
+)
+
+var comments = flag.Bool(
+	"comments", false,
+	"with asm, write the mnemonic of each command as a comment before it",
+)
+
+var limits interp.Limits
+
+func init() {
+	flag.IntVar(
+		&limits.Stack, "max-stack", 0,
+		"maximum number of values on the stack (0 for no limit)",
+	)
+	flag.IntVar(
+		&limits.CallDepth, "max-call-depth", 0,
+		"maximum number of nested calls (0 for no limit)",
+	)
+	flag.Int64Var(
+		&limits.HeapAddress, "max-heap-address", 0,
+		"highest heap address that can be used (0 for no limit)",
+	)
+	flag.Int64Var(
+		&limits.HeapCells, "max-heap-cells", 0,
+		"maximum number of different heap addresses that can be stored to"+
+			" (0 for no limit)",
+	)
+}
+
+// vmOptions returns the VM options selected by the command-line flags.
+func vmOptions() ([]interp.Option, error) {
+	stdio := interp.NewIO(stdin, os.Stdout)
+	switch *encoding {
+	case "utf8":
+		stdio.Encoding = interp.EncodingUTF8
+		if *replace {
+			stdio.Replacement = utf8.RuneError
+		}
+	case "latin1":
+		stdio.Encoding = interp.EncodingLatin1
+		if *replace {
+			stdio.Replacement = '?'
+		}
+	default:
+		return nil, fmt.Errorf("invalid encoding: %q", *encoding)
+	}
+
+	stdio.Prefixes = *prefixes
+
+	eofPolicy, eofValue, err := interp.ParseEOFPolicy(*eof)
+	if err != nil {
+		return nil, err
+	}
+	div, err := interp.ParseDivision(*division)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []interp.Option{
+		interp.WithIOHooks(stdio),
+		interp.WithEOF(eofPolicy, eofValue),
+		interp.WithDivision(div),
+	}
+	if *bigInts {
+		opts = append(opts, interp.WithBigInts())
+	}
+	if *checked {
+		opts = append(opts, interp.WithOverflowCheck())
+	}
+	if *maxInstructions > 0 {
+		opts = append(opts, interp.WithMaxInstructions(*maxInstructions))
+	}
+	opts = append(opts, interp.WithLimits(limits))
+	if *trace {
+		opts = append(opts, interp.WithTraceWriter(os.Stderr))
+	}
+	switch *heapKind {
+	case "auto":
+		opts = append(opts, interp.WithHeap(interp.NewAutoHeap()))
+	case "dense":
+		opts = append(opts, interp.WithHeap(&interp.DenseHeap{}))
+	case "sparse":
+		opts = append(opts, interp.WithHeap(interp.SparseHeap{}))
+	case "paged":
+		opts = append(opts, interp.WithHeap(&interp.PagedHeap{}))
+	default:
+		return nil, fmt.Errorf("invalid heap implementation: %q", *heapKind)
+	}
+
+	return opts, nil
+}
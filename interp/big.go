@@ -0,0 +1,279 @@
+package interp
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// This file holds the operations used in big integer mode, where the
+// values are *big.Int instead of int64.
+//
+// The values on the stack and heap are never modified in place, so the
+// same *big.Int can safely be in several places at once.
+
+var bigOps = [ast.CountCmds]func(*VM, int64){
+	(*VM).opInvalid, // CmdNone
+	// IMP: Stack Manipulation
+	(*VM).opBigPush,
+	(*VM).opBigDup,
+	(*VM).opBigCopy,
+	(*VM).opBigSwap,
+	(*VM).opBigDiscard,
+	(*VM).opBigSlide,
+	// IMP: Arithmetic
+	(*VM).opBigAdd,
+	(*VM).opBigSub,
+	(*VM).opBigMul,
+	(*VM).opBigDiv,
+	(*VM).opBigMod,
+	// IMP: Heap Access
+	(*VM).opBigStore,
+	(*VM).opBigRetrieve,
+	// IMP: Flow Control
+	(*VM).opInvalid, // CmdMark
+	(*VM).opCall,
+	(*VM).opJump,
+	(*VM).opBigJumpIfZero,
+	(*VM).opBigJumpIfNeg,
+	(*VM).opReturn,
+	(*VM).opExit,
+	// IMP: I/O
+	(*VM).opBigOutChar,
+	(*VM).opBigOutNumber,
+	(*VM).opBigReadChar,
+	(*VM).opBigReadNumber,
+}
+
+var bigZero = new(big.Int)
+
+func (vm *VM) opBigPush(arg int64) {
+	if vm.stackRoom(len(vm.BigStack)) {
+		vm.BigStack = append(vm.BigStack, vm.consts[arg])
+	}
+}
+
+func (vm *VM) opBigDup(_ int64) {
+	if vm.bigStackSize(1) && vm.stackRoom(len(vm.BigStack)) {
+		vm.BigStack = append(vm.BigStack, vm.BigStack[len(vm.BigStack)-1])
+	}
+}
+
+func (vm *VM) opBigCopy(arg int64) {
+	n := len(vm.BigStack)
+	if vm.stackArg(arg, n) && vm.stackRoom(n) {
+		vm.BigStack = append(vm.BigStack, vm.BigStack[n-1-int(arg)])
+	}
+}
+
+func (vm *VM) opBigSwap(_ int64) {
+	if vm.bigStackSize(2) {
+		p := len(vm.BigStack) - 2
+		vm.BigStack[p], vm.BigStack[p+1] = vm.BigStack[p+1], vm.BigStack[p]
+	}
+}
+
+func (vm *VM) opBigDiscard(_ int64) {
+	if vm.bigStackSize(1) {
+		vm.bigPop()
+	}
+}
+
+func (vm *VM) opBigSlide(arg int64) {
+	if vm.stackArg(arg, len(vm.BigStack)) {
+		p := len(vm.BigStack) - 1 - int(arg)
+		vm.BigStack[p] = vm.BigStack[len(vm.BigStack)-1]
+		vm.BigStack = vm.BigStack[:p+1]
+	}
+}
+
+func (vm *VM) opBigAdd(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		p := len(vm.BigStack) - 1
+		vm.BigStack[p] = new(big.Int).Add(vm.BigStack[p], b)
+	}
+}
+
+func (vm *VM) opBigSub(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		p := len(vm.BigStack) - 1
+		vm.BigStack[p] = new(big.Int).Sub(vm.BigStack[p], b)
+	}
+}
+
+func (vm *VM) opBigMul(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		p := len(vm.BigStack) - 1
+		vm.BigStack[p] = new(big.Int).Mul(vm.BigStack[p], b)
+	}
+}
+
+func (vm *VM) opBigDiv(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		if b.Sign() == 0 {
+			vm.divisionByZero()
+			return
+		}
+		p := len(vm.BigStack) - 1
+		vm.BigStack[p] = new(big.Int).Quo(vm.BigStack[p], b)
+	}
+}
+
+func (vm *VM) opBigMod(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		if b.Sign() == 0 {
+			vm.divisionByZero()
+			return
+		}
+		p := len(vm.BigStack) - 1
+		vm.BigStack[p] = new(big.Int).Rem(vm.BigStack[p], b)
+	}
+}
+
+func (vm *VM) opBigStore(_ int64) {
+	if vm.bigStackSize(2) {
+		p := len(vm.BigStack) - 2
+		adr, val := vm.BigStack[p], vm.BigStack[p+1]
+		vm.BigStack = vm.BigStack[:p]
+		if a, ok := vm.bigAddress(adr); ok {
+			vm.storeBigHeap(a, val)
+		}
+	}
+}
+
+func (vm *VM) opBigRetrieve(_ int64) {
+	if vm.bigStackSize(1) {
+		p := len(vm.BigStack) - 1
+		adr, ok := vm.bigAddress(vm.BigStack[p])
+		if !ok {
+			return
+		}
+		if v, ok := vm.BigHeap[adr]; ok {
+			vm.BigStack[p] = v
+		} else {
+			vm.BigStack[p] = bigZero
+		}
+	}
+}
+
+func (vm *VM) opBigJumpIfZero(arg int64) {
+	if vm.bigStackSize(1) && vm.bigPop().Sign() == 0 {
+		vm.PC = int(arg)
+	}
+}
+
+func (vm *VM) opBigJumpIfNeg(arg int64) {
+	if vm.bigStackSize(1) && vm.bigPop().Sign() < 0 {
+		vm.PC = int(arg)
+	}
+}
+
+func (vm *VM) opBigOutChar(_ int64) {
+	if vm.bigStackSize(1) {
+		v := vm.bigPop()
+		if !v.IsInt64() {
+			vm.fail("character value out of range: %v", v)
+			return
+		}
+		err := vm.WriteChar(v.Int64())
+		if err != nil && vm.Err == nil {
+			vm.Err = err
+		}
+	}
+}
+
+func (vm *VM) opBigOutNumber(_ int64) {
+	if vm.bigStackSize(1) {
+		err := vm.WriteBigNumber(vm.bigPop())
+		if err != nil && vm.Err == nil {
+			vm.Err = err
+		}
+	}
+}
+
+func (vm *VM) opBigReadChar(_ int64) {
+	if vm.bigStackSize(1) {
+		adr, ok := vm.bigAddress(vm.bigPop())
+		if !ok {
+			return
+		}
+		ch, err := vm.ReadChar()
+		val := big.NewInt(int64(ch))
+		if err == io.EOF && vm.eof != EOFError {
+			if vm.eof == EOFUnchanged {
+				return
+			}
+			val, err = big.NewInt(vm.eofValue), nil
+		}
+		if err != nil && vm.Err == nil {
+			vm.Err = err
+			return
+		}
+		vm.storeBigHeap(adr, val)
+	}
+}
+
+func (vm *VM) opBigReadNumber(_ int64) {
+	if vm.bigStackSize(1) {
+		adr, ok := vm.bigAddress(vm.bigPop())
+		if !ok {
+			return
+		}
+		val, err := vm.ReadBigNumber()
+		if err == io.EOF && vm.eof != EOFError {
+			if vm.eof == EOFUnchanged {
+				return
+			}
+			val, err = big.NewInt(vm.eofValue), nil
+		}
+		if err != nil && vm.Err == nil {
+			vm.Err = err
+			return
+		}
+		vm.storeBigHeap(adr, val)
+	}
+}
+
+func (vm *VM) bigStackSize(n int) bool {
+	if len(vm.BigStack) < n {
+		vm.fail("stack underflow")
+		return false
+	}
+	return vm.Err == nil
+}
+
+func (vm *VM) bigPop() *big.Int {
+	p := len(vm.BigStack) - 1
+	v := vm.BigStack[p]
+	vm.BigStack = vm.BigStack[:p]
+	return v
+}
+
+// bigAddress converts the given value to a heap address, if it is valid.
+func (vm *VM) bigAddress(adr *big.Int) (int64, bool) {
+	switch {
+	case adr.Sign() < 0:
+		vm.fail("negative heap address: %v", adr)
+	case !adr.IsInt64():
+		vm.fail("heap address too large: %v", adr)
+	default:
+		return adr.Int64(), true
+	}
+	return 0, false
+}
+
+func (vm *VM) storeBigHeap(adr int64, val *big.Int) {
+	cells := int64(len(vm.BigHeap))
+	if _, ok := vm.BigHeap[adr]; !ok {
+		cells++
+	}
+	if vm.heapRoom(adr, cells) {
+		vm.BigHeap[adr] = val
+	}
+}
@@ -0,0 +1,101 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// This file holds the operations used in checked arithmetic mode, where
+// an arithmetic operation whose result does not fit in an int64 is an
+// error instead of silently wrapping around.
+
+// OverflowError is the error for when the result of an arithmetic
+// instruction does not fit in an int64, in checked arithmetic mode.
+type OverflowError struct {
+	PC   int     // the index of the instruction in the code
+	Cmd  ast.Cmd // the command of the instruction
+	A, B int64   // the operands of the instruction
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf(
+		"integer overflow at instruction %v: %v %v %v",
+		e.PC, e.Cmd, e.A, e.B,
+	)
+}
+
+var checkedOps = func() [ast.CountCmds]func(*VM, int64) {
+	ops := vmOps
+	ops[ast.CmdAdd] = (*VM).opCheckedAdd
+	ops[ast.CmdSub] = (*VM).opCheckedSub
+	ops[ast.CmdMul] = (*VM).opCheckedMul
+	ops[ast.CmdDiv] = (*VM).opCheckedDiv
+	return ops
+}()
+
+func (vm *VM) opCheckedAdd(_ int64) {
+	if vm.stackSize(2) {
+		b := vm.pop()
+		p := len(vm.Stack) - 1
+		a := vm.Stack[p]
+		c := a + b
+		if (c > a) != (b > 0) {
+			vm.overflow(ast.CmdAdd, a, b)
+			return
+		}
+		vm.Stack[p] = c
+	}
+}
+
+func (vm *VM) opCheckedSub(_ int64) {
+	if vm.stackSize(2) {
+		b := vm.pop()
+		p := len(vm.Stack) - 1
+		a := vm.Stack[p]
+		c := a - b
+		if (c < a) != (b > 0) {
+			vm.overflow(ast.CmdSub, a, b)
+			return
+		}
+		vm.Stack[p] = c
+	}
+}
+
+func (vm *VM) opCheckedMul(_ int64) {
+	if vm.stackSize(2) {
+		b := vm.pop()
+		p := len(vm.Stack) - 1
+		a := vm.Stack[p]
+		c := a * b
+		if a != 0 && (c/a != b || (a == -1 && b == math.MinInt64)) {
+			vm.overflow(ast.CmdMul, a, b)
+			return
+		}
+		vm.Stack[p] = c
+	}
+}
+
+func (vm *VM) opCheckedDiv(_ int64) {
+	if vm.stackSize(2) {
+		b := vm.pop()
+		p := len(vm.Stack) - 1
+		a := vm.Stack[p]
+		if b == 0 {
+			vm.divisionByZero()
+			return
+		}
+		if a == math.MinInt64 && b == -1 {
+			vm.overflow(ast.CmdDiv, a, b)
+			return
+		}
+		vm.Stack[p] = a / b
+	}
+}
+
+func (vm *VM) overflow(cmd ast.Cmd, a, b int64) {
+	if vm.Err == nil {
+		vm.Err = &OverflowError{PC: vm.PC - 1, Cmd: cmd, A: a, B: b}
+	}
+}
@@ -1,31 +1,48 @@
 package interp
 
 import (
-	"fmt"
+	"math/big"
+	"os"
 )
 
 // This file holds the default implementations for reading and writing
 // characters and numbers.
-// For simplicity, these use stdin/stdout and decimal numbers.
+// For simplicity, these use stdin/stdout, UTF-8 and decimal numbers.
+//
+// They share one IO, so that input buffered by one of them is not lost
+// to the others, and flush the output after every write.
 
-func DefaultWriteChar(r rune) error {
-	_, err := fmt.Printf("%c", r)
-	return err
+var stdio = NewIO(os.Stdin, os.Stdout)
+
+func DefaultWriteChar(c int64) error {
+	if err := stdio.WriteChar(c); err != nil {
+		return err
+	}
+	return stdio.Flush()
 }
 
 func DefaultWriteNumber(n int64) error {
-	_, err := fmt.Printf("%d", n)
-	return err
+	if err := stdio.WriteNumber(n); err != nil {
+		return err
+	}
+	return stdio.Flush()
 }
 
 func DefaultReadChar() (rune, error) {
-	var r rune
-	_, err := fmt.Scanf("%c", &r)
-	return r, err
+	return stdio.ReadChar()
 }
 
 func DefaultReadNumber() (int64, error) {
-	var v int64
-	_, err := fmt.Scanf("%d\n", &v)
-	return v, err
+	return stdio.ReadNumber()
+}
+
+func DefaultWriteBigNumber(n *big.Int) error {
+	if err := stdio.WriteBigNumber(n); err != nil {
+		return err
+	}
+	return stdio.Flush()
+}
+
+func DefaultReadBigNumber() (*big.Int, error) {
+	return stdio.ReadBigNumber()
 }
@@ -0,0 +1,52 @@
+package interp
+
+import (
+	"fmt"
+)
+
+// Encoding selects how the characters read and written by the readc and
+// outc instructions are encoded in the input and output.
+type Encoding uint8
+
+const (
+	// EncodingUTF8 encodes each character as UTF-8, so the valid
+	// characters are the Unicode code points, except surrogates.
+	EncodingUTF8 Encoding = iota
+	// EncodingLatin1 encodes each character as a single byte with the
+	// same value, so the valid characters are 0-255. This is the same as
+	// ISO-8859-1 (Latin-1), and can also be used for raw binary data.
+	EncodingLatin1
+)
+
+// NoReplacement is the IO.Replacement value that makes invalid
+// characters an error instead of being replaced.
+const NoReplacement rune = -1
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingUTF8:
+		return "UTF-8"
+	case EncodingLatin1:
+		return "Latin-1"
+	}
+	return fmt.Sprintf("Encoding(%d)", uint8(e))
+}
+
+// CharError is the error for a character that is not valid in the
+// encoding used for the I/O.
+type CharError struct {
+	Encoding Encoding
+	// Value is the character that could not be written, if writing.
+	Value int64
+	// Input holds the bytes that could not be decoded, if reading.
+	Input []byte
+}
+
+func (e *CharError) Error() string {
+	if e.Input != nil {
+		return fmt.Sprintf("invalid %v input: % X", e.Encoding, e.Input)
+	}
+	return fmt.Sprintf(
+		"cannot write character %v: not valid in %v", e.Value, e.Encoding,
+	)
+}
@@ -0,0 +1,80 @@
+package interp
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// This file holds the div and mod operations used for DivFloor, which
+// round the quotient toward negative infinity.
+
+func (vm *VM) opFloorDiv(_ int64) {
+	if vm.stackSize(2) {
+		b := vm.pop()
+		p := len(vm.Stack) - 1
+		a := vm.Stack[p]
+		if b == 0 {
+			vm.divisionByZero()
+			return
+		}
+		if vm.checked && a == math.MinInt64 && b == -1 {
+			vm.overflow(ast.CmdDiv, a, b)
+			return
+		}
+		q := a / b
+		if a%b != 0 && (a < 0) != (b < 0) {
+			q--
+		}
+		vm.Stack[p] = q
+	}
+}
+
+func (vm *VM) opFloorMod(_ int64) {
+	if vm.stackSize(2) {
+		b := vm.pop()
+		p := len(vm.Stack) - 1
+		if b == 0 {
+			vm.divisionByZero()
+			return
+		}
+		m := vm.Stack[p] % b
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		vm.Stack[p] = m
+	}
+}
+
+func (vm *VM) opBigFloorDiv(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		if b.Sign() == 0 {
+			vm.divisionByZero()
+			return
+		}
+		p := len(vm.BigStack) - 1
+		q, m := new(big.Int).QuoRem(vm.BigStack[p], b, new(big.Int))
+		if m.Sign() != 0 && m.Sign() != b.Sign() {
+			q.Sub(q, big.NewInt(1))
+		}
+		vm.BigStack[p] = q
+	}
+}
+
+func (vm *VM) opBigFloorMod(_ int64) {
+	if vm.bigStackSize(2) {
+		b := vm.bigPop()
+		if b.Sign() == 0 {
+			vm.divisionByZero()
+			return
+		}
+		p := len(vm.BigStack) - 1
+		m := new(big.Int).Rem(vm.BigStack[p], b)
+		if m.Sign() != 0 && m.Sign() != b.Sign() {
+			m.Add(m, b)
+		}
+		vm.BigStack[p] = m
+	}
+}
@@ -0,0 +1,242 @@
+package interp
+
+// Heap is the storage for the heap of a VM.
+//
+// The VM checks that addresses are not negative before calling these
+// methods, so implementations do not need to handle that.
+type Heap interface {
+	// Load returns the value stored at the given address, or 0 if no
+	// value has been stored there.
+	Load(adr int64) int64
+	// Store stores the given value at the given address.
+	Store(adr, val int64)
+	// Cells returns the number of different addresses that have been
+	// stored to, which is counted the same way by every implementation.
+	Cells() int64
+	// CellsAfter returns the number of different addresses that would
+	// have been stored to after storing a value at the given address.
+	CellsAfter(adr int64) int64
+	// Range calls f for each address that has been stored to, in no
+	// particular order.
+	Range(f func(adr, val int64))
+}
+
+// DenseHeap is a Heap that stores the values in a slice indexed by the
+// address, which is fast and compact when the used addresses are low,
+// but wastes memory if any of them are high.
+//
+// The zero value is an empty heap.
+type DenseHeap struct {
+	vals []int64
+	used usedCells
+}
+
+func (h *DenseHeap) Load(adr int64) int64 {
+	if adr < int64(len(h.vals)) {
+		return h.vals[adr]
+	}
+	return 0
+}
+
+func (h *DenseHeap) Store(adr, val int64) {
+	switch {
+	case int64(len(h.vals)) > adr:
+		// Nothing to do
+	case int64(cap(h.vals)) > adr:
+		h.vals = h.vals[:adr+1]
+	default:
+		for int64(len(h.vals)) <= adr {
+			h.vals = append(h.vals[:cap(h.vals)], 0)
+		}
+	}
+	h.vals[adr] = val
+	h.used.set(adr)
+}
+
+func (h *DenseHeap) Cells() int64 {
+	return h.used.count
+}
+
+func (h *DenseHeap) CellsAfter(adr int64) int64 {
+	return h.used.countAfter(adr)
+}
+
+func (h *DenseHeap) Range(f func(adr, val int64)) {
+	for adr, val := range h.vals {
+		if h.used.has(int64(adr)) {
+			f(int64(adr), val)
+		}
+	}
+}
+
+// SparseHeap is a Heap that stores the values in a map, which only
+// uses memory for the addresses that are used, but is slower than the
+// other heaps.
+type SparseHeap map[int64]int64
+
+func (h SparseHeap) Load(adr int64) int64 {
+	return h[adr]
+}
+
+func (h SparseHeap) Store(adr, val int64) {
+	h[adr] = val
+}
+
+func (h SparseHeap) Cells() int64 {
+	return int64(len(h))
+}
+
+func (h SparseHeap) CellsAfter(adr int64) int64 {
+	if _, ok := h[adr]; ok {
+		return int64(len(h))
+	}
+	return int64(len(h)) + 1
+}
+
+func (h SparseHeap) Range(f func(adr, val int64)) {
+	for adr, val := range h {
+		f(adr, val)
+	}
+}
+
+// PageSize is the number of cells in each page of a PagedHeap.
+const PageSize = 1024
+
+// PagedHeap is a Heap that stores the values in pages of PageSize cells,
+// allocated as needed, which is nearly as fast as DenseHeap while using
+// little memory for programs that use a few areas at high addresses.
+//
+// The zero value is an empty heap.
+type PagedHeap struct {
+	pages map[int64]*heapPage
+	// cells is the number of addresses that have been stored to.
+	cells int64
+}
+
+type heapPage struct {
+	vals [PageSize]int64
+	used [PageSize / 64]uint64
+}
+
+func (h *PagedHeap) Load(adr int64) int64 {
+	if page, ok := h.pages[adr/PageSize]; ok {
+		return page.vals[adr%PageSize]
+	}
+	return 0
+}
+
+func (h *PagedHeap) Store(adr, val int64) {
+	page, ok := h.pages[adr/PageSize]
+	if !ok {
+		if h.pages == nil {
+			h.pages = map[int64]*heapPage{}
+		}
+		page = new(heapPage)
+		h.pages[adr/PageSize] = page
+	}
+	page.vals[adr%PageSize] = val
+	if used := usedBits(page.used[:]); !used.has(adr % PageSize) {
+		used.set(adr % PageSize)
+		h.cells++
+	}
+}
+
+func (h *PagedHeap) Cells() int64 {
+	return h.cells
+}
+
+func (h *PagedHeap) CellsAfter(adr int64) int64 {
+	page, ok := h.pages[adr/PageSize]
+	if ok && usedBits(page.used[:]).has(adr%PageSize) {
+		return h.cells
+	}
+	return h.cells + 1
+}
+
+func (h *PagedHeap) Range(f func(adr, val int64)) {
+	for n, page := range h.pages {
+		used := usedBits(page.used[:])
+		for i, val := range page.vals {
+			if used.has(int64(i)) {
+				f(n*PageSize+int64(i), val)
+			}
+		}
+	}
+}
+
+// usedBits is a bit set of the addresses that have been stored to.
+type usedBits []uint64
+
+func (b usedBits) has(adr int64) bool {
+	return adr/64 < int64(len(b)) && b[adr/64]&(1<<uint(adr%64)) != 0
+}
+
+// set sets the bit of the given address, which must be within the set.
+func (b usedBits) set(adr int64) {
+	b[adr/64] |= 1 << uint(adr%64)
+}
+
+// usedCells is a growable usedBits that also counts the addresses.
+type usedCells struct {
+	bits  usedBits
+	count int64
+}
+
+func (u *usedCells) has(adr int64) bool {
+	return u.bits.has(adr)
+}
+
+func (u *usedCells) set(adr int64) {
+	if u.bits.has(adr) {
+		return
+	}
+	if n := adr/64 + 1; n > int64(len(u.bits)) {
+		u.bits = append(u.bits, make(usedBits, n-int64(len(u.bits)))...)
+	}
+	u.bits.set(adr)
+	u.count++
+}
+
+func (u *usedCells) countAfter(adr int64) int64 {
+	if u.bits.has(adr) {
+		return u.count
+	}
+	return u.count + 1
+}
+
+// autoDensity is how many times more cells than it uses (plus a page)
+// AutoHeap lets its dense heap grow to, before switching to paged.
+const autoDensity = 4
+
+// AutoHeap is a Heap that starts out as a DenseHeap, and switches to a
+// PagedHeap if the program stores to an address that would make the
+// dense heap a lot larger than the number of cells it uses.
+type AutoHeap struct {
+	Heap
+}
+
+func NewAutoHeap() *AutoHeap {
+	return &AutoHeap{Heap: &DenseHeap{}}
+}
+
+func (h *AutoHeap) Store(adr, val int64) {
+	if h.shouldSwitch(adr) {
+		// Copy every cell that has been stored to, even if it holds 0,
+		// so that the number of cells stays the same.
+		paged := &PagedHeap{}
+		h.Heap.Range(paged.Store)
+		h.Heap = paged
+	}
+	h.Heap.Store(adr, val)
+}
+
+// shouldSwitch returns true if storing to the given address should make
+// the heap switch from dense to paged storage.
+func (h *AutoHeap) shouldSwitch(adr int64) bool {
+	dense, ok := h.Heap.(*DenseHeap)
+	if !ok {
+		return false
+	}
+	size := int64(len(dense.vals))
+	return adr >= size && adr >= autoDensity*(dense.used.count+PageSize)
+}
@@ -2,6 +2,7 @@ package interp
 
 import (
 	"errors"
+	"io"
 
 	"github.com/edorfaus/whitespace/ast"
 )
@@ -9,12 +10,19 @@ import (
 type Instr struct {
 	Op  func(*VM, int64)
 	Arg int64
+	Cmd ast.Cmd
+	Pos ast.Pos
 }
 
 // errProgramExit is a sentinel value for when the program executed the
 // end-the-program operation (the exit instruction).
 var errProgramExit = errors.New("program exited")
 
+// ErrDivisionByZero is the error for when a div or mod instruction was
+// executed with a divisor of zero. It is wrapped in an error that says
+// which instruction it was.
+var ErrDivisionByZero = errors.New("division by zero")
+
 var vmOps = [ast.CountCmds]func(*VM, int64){
 	(*VM).opInvalid, // CmdNone
 	// IMP: Stack Manipulation
@@ -53,20 +61,20 @@ func (vm *VM) opInvalid(_ int64) {
 }
 
 func (vm *VM) opPush(arg int64) {
-	vm.Stack = append(vm.Stack, arg)
+	if vm.stackRoom(len(vm.Stack)) {
+		vm.Stack = append(vm.Stack, arg)
+	}
 }
 
 func (vm *VM) opDup(_ int64) {
-	if vm.stackSize(1) {
+	if vm.stackSize(1) && vm.stackRoom(len(vm.Stack)) {
 		vm.Stack = append(vm.Stack, vm.Stack[len(vm.Stack)-1])
 	}
 }
 
 func (vm *VM) opCopy(arg int64) {
-	// TODO validate arg is within int range
-	n := int(arg)
-	if vm.stackSize(n + 1) {
-		vm.Stack = append(vm.Stack, vm.Stack[len(vm.Stack)-1-n])
+	if vm.stackArg(arg, len(vm.Stack)) && vm.stackRoom(len(vm.Stack)) {
+		vm.Stack = append(vm.Stack, vm.Stack[len(vm.Stack)-1-int(arg)])
 	}
 }
 
@@ -84,10 +92,8 @@ func (vm *VM) opDiscard(_ int64) {
 }
 
 func (vm *VM) opSlide(arg int64) {
-	// TODO validate arg is within int range
-	n := int(arg)
-	if vm.stackSize(n + 1) {
-		p := len(vm.Stack) - 1 - n
+	if vm.stackArg(arg, len(vm.Stack)) {
+		p := len(vm.Stack) - 1 - int(arg)
 		vm.Stack[p] = vm.Stack[len(vm.Stack)-1]
 		vm.Stack = vm.Stack[:p+1]
 	}
@@ -117,6 +123,10 @@ func (vm *VM) opMul(_ int64) {
 func (vm *VM) opDiv(_ int64) {
 	if vm.stackSize(2) {
 		b := vm.pop()
+		if b == 0 {
+			vm.divisionByZero()
+			return
+		}
 		vm.Stack[len(vm.Stack)-1] /= b
 	}
 }
@@ -124,6 +134,10 @@ func (vm *VM) opDiv(_ int64) {
 func (vm *VM) opMod(_ int64) {
 	if vm.stackSize(2) {
 		b := vm.pop()
+		if b == 0 {
+			vm.divisionByZero()
+			return
+		}
 		vm.Stack[len(vm.Stack)-1] %= b
 	}
 }
@@ -140,19 +154,19 @@ func (vm *VM) opRetrieve(_ int64) {
 	if vm.stackSize(1) {
 		p := len(vm.Stack) - 1
 		adr := vm.Stack[p]
-		switch {
-		case adr < 0:
+		if adr < 0 {
 			vm.fail("retrieve from negative heap address: %v", adr)
 			return
-		case int64(len(vm.Heap)) > adr:
-			vm.Stack[p] = vm.Heap[adr]
-		default:
-			vm.Stack[p] = 0
 		}
+		vm.Stack[p] = vm.Heap.Load(adr)
 	}
 }
 
 func (vm *VM) opCall(arg int64) {
+	if max := vm.limits.CallDepth; max > 0 && len(vm.RetTo) >= max {
+		vm.limitExceeded(ResourceCallDepth, int64(max))
+		return
+	}
 	vm.RetTo = append(vm.RetTo, vm.PC)
 	vm.PC = int(arg)
 }
@@ -191,7 +205,7 @@ func (vm *VM) opExit(_ int64) {
 
 func (vm *VM) opOutChar(_ int64) {
 	if vm.stackSize(1) {
-		err := vm.WriteChar(rune(vm.pop()))
+		err := vm.WriteChar(vm.pop())
 		if err != nil && vm.Err == nil {
 			vm.Err = err
 		}
@@ -211,11 +225,18 @@ func (vm *VM) opReadChar(_ int64) {
 	if vm.stackSize(1) {
 		adr := vm.pop()
 		ch, err := vm.ReadChar()
+		val := int64(ch)
+		if err == io.EOF && vm.eof != EOFError {
+			if vm.eof == EOFUnchanged {
+				return
+			}
+			val, err = vm.eofValue, nil
+		}
 		if err != nil && vm.Err == nil {
 			vm.Err = err
 			return
 		}
-		vm.storeHeap(adr, int64(ch))
+		vm.storeHeap(adr, val)
 	}
 }
 
@@ -223,6 +244,12 @@ func (vm *VM) opReadNumber(_ int64) {
 	if vm.stackSize(1) {
 		adr := vm.pop()
 		val, err := vm.ReadNumber()
+		if err == io.EOF && vm.eof != EOFError {
+			if vm.eof == EOFUnchanged {
+				return
+			}
+			val, err = vm.eofValue, nil
+		}
 		if err != nil && vm.Err == nil {
 			vm.Err = err
 			return
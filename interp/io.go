@@ -0,0 +1,241 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// IO implements the I/O hooks of a VM on top of an io.Reader and an
+// io.Writer, with buffering in both directions.
+//
+// Buffered output is flushed before reading input, so that any prompt
+// is shown before the program waits for input, and the VM flushes it
+// when it stops running.
+type IO struct {
+	// Encoding is the encoding used for reading and writing characters.
+	Encoding Encoding
+	// Replacement is the character used instead of any character that is
+	// not valid in the encoding, or NoReplacement to make that an error
+	// (a *CharError). It must itself be valid in the encoding.
+	Replacement rune
+	// Prefixes enables reading numbers in other bases than decimal, by
+	// using the prefixes 0x (hex), 0o (octal) and 0b (binary).
+	Prefixes bool
+
+	r *bufio.Reader
+	w *bufio.Writer
+
+	buf []byte
+}
+
+// NewIO returns an IO that reads from r and writes to w, using UTF-8
+// without replacement of invalid characters.
+func NewIO(r io.Reader, w io.Writer) *IO {
+	return &IO{
+		Encoding:    EncodingUTF8,
+		Replacement: NoReplacement,
+
+		r: bufio.NewReader(r),
+		w: bufio.NewWriter(w),
+	}
+}
+
+// WithIO makes the VM read its input from r and write its output to w,
+// with buffering, using an IO with the default settings.
+func WithIO(r io.Reader, w io.Writer) Option {
+	return WithIOHooks(NewIO(r, w))
+}
+
+// WithIOHooks makes the VM use the given IO for all its I/O.
+func WithIOHooks(c *IO) Option {
+	return func(vm *VM) {
+		vm.WriteChar = c.WriteChar
+		vm.WriteNumber = c.WriteNumber
+		vm.ReadChar = c.ReadChar
+		vm.ReadNumber = c.ReadNumber
+		vm.WriteBigNumber = c.WriteBigNumber
+		vm.ReadBigNumber = c.ReadBigNumber
+		vm.Flush = c.Flush
+	}
+}
+
+// Flush writes any buffered output to the underlying io.Writer.
+func (c *IO) Flush() error {
+	return c.w.Flush()
+}
+
+func (c *IO) WriteChar(v int64) error {
+	if !c.validChar(v) {
+		if c.Replacement == NoReplacement {
+			return &CharError{Encoding: c.Encoding, Value: v}
+		}
+		v = int64(c.Replacement)
+	}
+	var err error
+	if c.Encoding == EncodingLatin1 {
+		err = c.w.WriteByte(byte(v))
+	} else {
+		_, err = c.w.WriteRune(rune(v))
+	}
+	return err
+}
+
+// validChar returns true if the given character is valid in the encoding.
+func (c *IO) validChar(v int64) bool {
+	if c.Encoding == EncodingLatin1 {
+		return v >= 0 && v <= 0xFF
+	}
+	return int64(rune(v)) == v && utf8.ValidRune(rune(v))
+}
+
+func (c *IO) WriteNumber(n int64) error {
+	c.buf = strconv.AppendInt(c.buf[:0], n, 10)
+	_, err := c.w.Write(c.buf)
+	return err
+}
+
+func (c *IO) WriteBigNumber(n *big.Int) error {
+	c.buf = n.Append(c.buf[:0], 10)
+	_, err := c.w.Write(c.buf)
+	return err
+}
+
+func (c *IO) ReadChar() (rune, error) {
+	if err := c.Flush(); err != nil {
+		return 0, err
+	}
+	if c.Encoding == EncodingLatin1 {
+		b, err := c.r.ReadByte()
+		return rune(b), err
+	}
+	r, size, err := c.r.ReadRune()
+	if err != nil || r != utf8.RuneError || size != 1 {
+		return r, err
+	}
+	// Invalid UTF-8, which ReadRune returns as RuneError of size 1.
+	if c.Replacement != NoReplacement {
+		return c.Replacement, nil
+	}
+	if err := c.r.UnreadRune(); err != nil {
+		return 0, err
+	}
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return 0, &CharError{Encoding: c.Encoding, Input: []byte{b}}
+}
+
+// ReadNumber reads a line of input and parses it as a number.
+//
+// The number is in decimal, unless Prefixes is enabled and it has a
+// prefix for another base, and it can have a sign (+ or -). Any space
+// around the number is ignored, including the CR of a CRLF line ending.
+// The last line does not need a line ending.
+//
+// If the input has ended, so there is no line to read, io.EOF is
+// returned as the error. If the line is not a valid number, or is too
+// large for an int64, a *NumberError is returned.
+func (c *IO) ReadNumber() (int64, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return 0, err
+	}
+	digits, base, ok := c.splitNumber(line)
+	if !ok {
+		return 0, &NumberError{Input: line, Err: strconv.ErrSyntax}
+	}
+	v, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, &NumberError{Input: line, Err: err.(*strconv.NumError).Err}
+	}
+	return v, nil
+}
+
+// ReadBigNumber is like ReadNumber, but without any limit on the size of
+// the number.
+func (c *IO) ReadBigNumber() (*big.Int, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	digits, base, ok := c.splitNumber(line)
+	if !ok {
+		return nil, &NumberError{Input: line, Err: strconv.ErrSyntax}
+	}
+	v, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, &NumberError{Input: line, Err: strconv.ErrSyntax}
+	}
+	return v, nil
+}
+
+// splitNumber returns the sign and digits of the number in the line, in
+// a form that strconv.ParseInt accepts, and the base of the digits.
+// It returns false if the line obviously does not hold a valid number.
+func (c *IO) splitNumber(line string) (string, int, bool) {
+	s := strings.TrimSpace(line)
+	sign := ""
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		if s[0] == '-' {
+			sign = "-"
+		}
+		s = s[1:]
+	}
+	base := 10
+	if c.Prefixes && len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			s = s[2:]
+		}
+	}
+	if s == "" || s[0] == '+' || s[0] == '-' {
+		return "", 0, false
+	}
+	return sign + s, base, true
+}
+
+// NumberError is the error for a line of input that could not be parsed
+// as a number.
+type NumberError struct {
+	Input string // the line that was read
+	Err   error  // the reason, strconv.ErrSyntax or strconv.ErrRange
+}
+
+func (e *NumberError) Error() string {
+	if e.Err == strconv.ErrRange {
+		return fmt.Sprintf("number input out of range: %q", e.Input)
+	}
+	return fmt.Sprintf("invalid number input: %q", e.Input)
+}
+
+func (e *NumberError) Unwrap() error {
+	return e.Err
+}
+
+// readLine reads a line of input, without the line terminator.
+func (c *IO) readLine() (string, error) {
+	if err := c.Flush(); err != nil {
+		return "", err
+	}
+	line, err := c.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
@@ -0,0 +1,91 @@
+package interp
+
+import (
+	"fmt"
+)
+
+// Limits holds the resource limits of a VM, to stop programs from using
+// too much memory. A limit of 0 means that there is no limit.
+type Limits struct {
+	// Stack is the maximum number of values on the stack.
+	Stack int
+	// CallDepth is the maximum number of calls that have not returned.
+	CallDepth int
+	// HeapAddress is the highest heap address that can be stored to.
+	HeapAddress int64
+	// HeapCells is the maximum number of different heap addresses that
+	// can be stored to. That is counted the same way for every Heap
+	// implementation, and in big integer mode, no matter how much memory
+	// the heap actually uses for them.
+	HeapCells int64
+}
+
+// Resource identifies a resource that has a limit.
+type Resource uint8
+
+const (
+	ResourceStack Resource = iota + 1
+	ResourceCallDepth
+	ResourceHeapAddress
+	ResourceHeapCells
+)
+
+var resourceNames = [...]string{
+	ResourceStack:       "stack size",
+	ResourceCallDepth:   "call depth",
+	ResourceHeapAddress: "heap address",
+	ResourceHeapCells:   "heap cells",
+}
+
+func (r Resource) String() string {
+	if int(r) < len(resourceNames) && resourceNames[r] != "" {
+		return resourceNames[r]
+	}
+	return fmt.Sprintf("Resource(%d)", uint8(r))
+}
+
+// LimitError is the error for when the program tried to go past one of
+// the resource limits.
+type LimitError struct {
+	Resource Resource
+	Limit    int64
+	PC       int // the index of the instruction in the code
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf(
+		"%v limit (%v) exceeded at instruction %v",
+		e.Resource, e.Limit, e.PC,
+	)
+}
+
+func (vm *VM) limitExceeded(r Resource, limit int64) {
+	if vm.Err == nil {
+		vm.Err = &LimitError{Resource: r, Limit: limit, PC: vm.PC - 1}
+	}
+}
+
+// stackRoom returns true if a value can be added to a stack that has the
+// given size, without going past the stack limit.
+func (vm *VM) stackRoom(size int) bool {
+	if max := vm.limits.Stack; max > 0 && size >= max {
+		vm.limitExceeded(ResourceStack, int64(max))
+		return false
+	}
+	return true
+}
+
+// heapRoom returns true if a value can be stored to the given heap
+// address, when that would make the heap have the given number of
+// cells, without going past the heap limits.
+func (vm *VM) heapRoom(adr, cells int64) bool {
+	if max := vm.limits.HeapAddress; max > 0 && adr > max {
+		vm.limitExceeded(ResourceHeapAddress, max)
+		return false
+	}
+	if max := vm.limits.HeapCells; max > 0 && cells > max {
+		vm.limitExceeded(ResourceHeapCells, max)
+		return false
+	}
+	return true
+}
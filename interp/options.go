@@ -0,0 +1,135 @@
+package interp
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Option is an option that changes how a VM works.
+type Option func(*VM)
+
+// WithBigInts enables big integer mode, in which the values on the stack
+// and heap are *big.Int values, without any limit on their size, and
+// BigStack and BigHeap are used instead of Stack and Heap.
+//
+// Heap addresses must still fit in an int64 in this mode.
+func WithBigInts() Option {
+	return func(vm *VM) {
+		vm.big = true
+		vm.BigHeap = map[int64]*big.Int{}
+	}
+}
+
+// WithOverflowCheck enables checked arithmetic mode, in which it is an
+// error (an *OverflowError) if the result of an arithmetic instruction
+// does not fit in an int64, instead of silently wrapping around.
+//
+// This has no effect in big integer mode, which cannot overflow.
+func WithOverflowCheck() Option {
+	return func(vm *VM) {
+		vm.checked = true
+	}
+}
+
+// Division selects how the div and mod instructions round the result.
+type Division uint8
+
+const (
+	// DivTruncate rounds the quotient toward zero, so the remainder has
+	// the sign of the dividend. This is how Go's / and % operators work.
+	DivTruncate Division = iota
+	// DivFloor rounds the quotient toward negative infinity, so the
+	// remainder has the sign of the divisor. This is how the reference
+	// implementation works, as it uses Haskell's div and mod.
+	DivFloor
+)
+
+// ParseDivision parses the name of a division mode, which is "trunc" for
+// DivTruncate or "floor" for DivFloor.
+func ParseDivision(s string) (Division, error) {
+	switch s {
+	case "trunc":
+		return DivTruncate, nil
+	case "floor":
+		return DivFloor, nil
+	}
+	return 0, fmt.Errorf("invalid division mode: %q", s)
+}
+
+// WithDivision selects how the div and mod instructions round the
+// result. The default is DivTruncate.
+func WithDivision(d Division) Option {
+	return func(vm *VM) {
+		vm.div = d
+	}
+}
+
+// WithMaxInstructions sets the instruction budget, which is the maximum
+// number of instructions the VM will execute. Trying to execute more
+// than that is an error that wraps ErrBudgetExceeded.
+//
+// A budget of 0 (the default) means there is no limit.
+func WithMaxInstructions(n int64) Option {
+	return func(vm *VM) {
+		vm.maxInstructions = n
+	}
+}
+
+// WithLimits sets the resource limits of the VM. Trying to go past one
+// of them is an error (a *LimitError).
+func WithLimits(l Limits) Option {
+	return func(vm *VM) {
+		vm.limits = l
+	}
+}
+
+// WithHeap sets the heap implementation to use, which is an AutoHeap by
+// default. This has no effect in big integer mode, which always stores
+// the heap in a map (BigHeap).
+func WithHeap(h Heap) Option {
+	return func(vm *VM) {
+		vm.Heap = h
+	}
+}
+
+// EOFPolicy selects what the readc and readn instructions do when the
+// input has ended, so there is nothing to read. Other interpreters do
+// different things in this case, and programs may depend on it.
+type EOFPolicy uint8
+
+const (
+	// EOFError stops the program with io.EOF as the error.
+	EOFError EOFPolicy = iota
+	// EOFValue stores a configured value, as if it had been read.
+	// This is usually -1 or 0.
+	EOFValue
+	// EOFUnchanged leaves the heap unchanged, not storing anything.
+	EOFUnchanged
+)
+
+// ParseEOFPolicy parses an end of input policy, which is "error" for
+// EOFError, "unchanged" for EOFUnchanged, or a number for EOFValue, in
+// which case that number is returned as the value to store.
+func ParseEOFPolicy(s string) (EOFPolicy, int64, error) {
+	switch s {
+	case "error":
+		return EOFError, 0, nil
+	case "unchanged":
+		return EOFUnchanged, 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end of input policy: %q", s)
+	}
+	return EOFValue, v, nil
+}
+
+// WithEOF sets the policy for what happens at the end of the input, and
+// the value to store for the EOFValue policy. The default is EOFError.
+func WithEOF(p EOFPolicy, value int64) Option {
+	return func(vm *VM) {
+		vm.eof = p
+		vm.eofValue = value
+	}
+}
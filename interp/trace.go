@@ -0,0 +1,120 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// TraceEvent describes the execution of a single instruction.
+type TraceEvent struct {
+	PC  int     // the index of the instruction in the code
+	Cmd ast.Cmd // the command of the instruction
+	Pos ast.Pos // the source position of the instruction
+	// Arg is the argument of the instruction, or nil if it has none.
+	// It is the number for push, copy and slide (an int64, or a *big.Int
+	// in big integer mode), and the target index for calls and jumps.
+	Arg interface{}
+	// Before and After are the values on top of the stack before and
+	// after the instruction was executed, or nil if the stack was empty.
+	// They are int64 values, or *big.Int values in big integer mode.
+	Before, After interface{}
+	// Err is the error the instruction caused, if any.
+	Err error
+}
+
+func (e TraceEvent) String() string {
+	s := fmt.Sprintf("%6d %-18v %v", e.PC, e.Pos, e.Cmd)
+	if e.Arg != nil {
+		s += fmt.Sprintf(" %v", e.Arg)
+	}
+	s = fmt.Sprintf(
+		"%-40s top: %v -> %v", s, traceValue(e.Before), traceValue(e.After),
+	)
+	if e.Err != nil {
+		s += fmt.Sprintf(" error: %v", e.Err)
+	}
+	return s
+}
+
+func traceValue(v interface{}) interface{} {
+	if v == nil {
+		return "-"
+	}
+	return v
+}
+
+// WithTrace makes the VM call the given function after executing each
+// instruction, with a description of what it did.
+func WithTrace(f func(TraceEvent)) Option {
+	return func(vm *VM) {
+		vm.Trace = f
+	}
+}
+
+// WithTraceWriter makes the VM write a human-readable line to w for
+// each instruction it executes, describing what it did.
+func WithTraceWriter(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.Trace = func(e TraceEvent) {
+			_, err := fmt.Fprintln(w, e)
+			if err != nil && vm.Err == nil {
+				vm.Err = err
+			}
+		}
+	}
+}
+
+// traceStep executes the instruction at PC like step does, while
+// calling the Trace hook with a description of it.
+func (vm *VM) traceStep() {
+	i := &vm.Code[vm.PC]
+	e := TraceEvent{
+		PC:     vm.PC,
+		Cmd:    i.Cmd,
+		Pos:    i.Pos,
+		Arg:    vm.InstrArg(vm.PC),
+		Before: vm.top(),
+	}
+	vm.PC++
+	vm.Executed++
+	i.Op(vm, i.Arg)
+	e.After = vm.top()
+	if vm.Err != errProgramExit {
+		e.Err = vm.Err
+	}
+	vm.Trace(e)
+}
+
+// InstrArg returns the argument of the instruction at the given index,
+// in the same form as TraceEvent.Arg.
+func (vm *VM) InstrArg(pc int) interface{} {
+	i := vm.Code[pc]
+	switch i.Cmd {
+	case ast.CmdPush:
+		if vm.big {
+			return vm.consts[i.Arg]
+		}
+		return i.Arg
+	case ast.CmdCopy, ast.CmdSlide:
+		return i.Arg
+	case ast.CmdCall, ast.CmdJump, ast.CmdJumpIfZero, ast.CmdJumpIfNeg:
+		return int(i.Arg)
+	}
+	return nil
+}
+
+// top returns the value on top of the stack, or nil if it is empty.
+func (vm *VM) top() interface{} {
+	if vm.big {
+		if len(vm.BigStack) == 0 {
+			return nil
+		}
+		return vm.BigStack[len(vm.BigStack)-1]
+	}
+	if len(vm.Stack) == 0 {
+		return nil
+	}
+	return vm.Stack[len(vm.Stack)-1]
+}
@@ -1,47 +1,241 @@
 package interp
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/edorfaus/whitespace/ast"
 )
 
 type VM struct {
-	WriteChar   func(rune) error
+	WriteChar   func(int64) error
 	WriteNumber func(int64) error
 	ReadChar    func() (rune, error)
 	ReadNumber  func() (int64, error)
 
+	WriteBigNumber func(*big.Int) error
+	ReadBigNumber  func() (*big.Int, error)
+
+	// Flush, if not nil, is called to flush any buffered output when the
+	// VM stops running.
+	Flush func() error
+
+	// Trace, if not nil, is called after each instruction is executed.
+	Trace func(TraceEvent)
+
 	Code  []Instr
 	Stack []int64
-	Heap  []int64
+	Heap  Heap
 	RetTo []int
 	PC    int
 	Err   error
+
+	// Executed is the number of instructions that have been executed.
+	Executed int64
+
+	// Labels maps each label to the index of the instruction it marks.
+	Labels map[string]int
+
+	exited bool
+
+	// These are used instead of Stack and Heap in big integer mode.
+	BigStack []*big.Int
+	BigHeap  map[int64]*big.Int
+
+	// big enables big integer mode, and consts holds the values pushed
+	// by the push instructions in that mode.
+	big    bool
+	consts []*big.Int
+
+	// checked enables checked arithmetic mode.
+	checked bool
+
+	// div selects the rounding mode of the div and mod instructions.
+	div Division
+
+	// maxInstructions is the instruction budget, or 0 for no limit.
+	maxInstructions int64
+
+	limits Limits
+
+	// eof is the policy for reading at the end of the input, and
+	// eofValue is the value used by the EOFValue policy.
+	eof      EOFPolicy
+	eofValue int64
 }
 
-func NewVM(code []ast.Command) *VM {
+// ErrBudgetExceeded is the error for when the program tried to execute
+// more instructions than the instruction budget allows.
+var ErrBudgetExceeded = errors.New("instruction budget exceeded")
+
+// contextCheckInterval is how many instructions RunContext executes
+// between each time it checks if the context has been cancelled.
+const contextCheckInterval = 4096
+
+// maxInt is the largest value of an int, used by Run as the number of
+// instructions to execute.
+const maxInt = int(^uint(0) >> 1)
+
+func NewVM(code []ast.Command, opts ...Option) *VM {
 	vm := &VM{
 		WriteChar:   DefaultWriteChar,
 		WriteNumber: DefaultWriteNumber,
 		ReadChar:    DefaultReadChar,
 		ReadNumber:  DefaultReadNumber,
+
+		WriteBigNumber: DefaultWriteBigNumber,
+		ReadBigNumber:  DefaultReadBigNumber,
+	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	if vm.Heap == nil {
+		vm.Heap = NewAutoHeap()
 	}
 	vm.translate(code)
 	return vm
 }
 
+// Run executes instructions until the VM halts, either because the
+// program exited or because of an error.
 func (vm *VM) Run() {
-	if vm.Err != nil {
+	for !vm.Halted() {
+		vm.run(maxInt)
+	}
+	vm.flush()
+}
+
+// RunContext is like Run, but also stops if the context is cancelled
+// (or its deadline passes), in which case Err is set to ctx.Err().
+//
+// The context is only checked every few thousand instructions, so the
+// VM may execute a few more instructions after the cancellation.
+func (vm *VM) RunContext(ctx context.Context) {
+	done := ctx.Done()
+	if done == nil {
+		// The context can never be cancelled, so do not check it.
+		vm.Run()
+		return
+	}
+	for !vm.Halted() {
+		select {
+		case <-done:
+			vm.Err = ctx.Err()
+			return
+		default:
+		}
+		vm.RunN(contextCheckInterval)
+	}
+}
+
+// RunN executes at most n instructions, stopping early if the VM halts.
+// It returns the number of instructions that were executed.
+func (vm *VM) RunN(n int) int {
+	done := vm.run(n)
+	vm.flush()
+	return done
+}
+
+// Step executes exactly one instruction, unless the VM has halted.
+func (vm *VM) Step() {
+	if !vm.Halted() {
+		vm.step()
+		vm.flush()
+	}
+}
+
+// Halted returns true if the VM cannot execute any more instructions,
+// either because the program exited or because of an error (in Err).
+func (vm *VM) Halted() bool {
+	return vm.Err != nil || vm.exited
+}
+
+// BigInts returns true if the VM is in big integer mode.
+func (vm *VM) BigInts() bool {
+	return vm.big
+}
+
+// Exited returns true if the program exited by executing the exit
+// instruction.
+func (vm *VM) Exited() bool {
+	return vm.exited
+}
+
+// flush flushes any buffered output, if the VM has a Flush hook.
+func (vm *VM) flush() {
+	if vm.Flush == nil {
+		return
+	}
+	if err := vm.Flush(); err != nil && vm.Err == nil {
+		vm.Err = err
+	}
+}
+
+// run executes at most n instructions, stopping early if the VM halts,
+// and returns the number of instructions that were executed.
+func (vm *VM) run(n int) int {
+	if vm.Trace == nil && vm.maxInstructions == 0 {
+		return vm.runFast(n)
+	}
+	done := 0
+	for ; done < n && !vm.Halted(); done++ {
+		vm.step()
+	}
+	return done
+}
+
+// runFast is like run, but skips the checks for tracing and the
+// instruction budget, so it must only be used when those are not used.
+//
+// This is the loop that most programs spend most of their time in, so
+// it is kept as simple as possible.
+func (vm *VM) runFast(n int) int {
+	if vm.exited {
+		return 0
+	}
+	code := vm.Code
+	done := 0
+	for ; done < n && vm.Err == nil; done++ {
+		if vm.PC < 0 || vm.PC >= len(code) {
+			vm.fail("execution went outside the code, at index %v", vm.PC)
+			break
+		}
+		i := &code[vm.PC]
+		vm.PC++
+		i.Op(vm, i.Arg)
+	}
+	vm.Executed += int64(done)
+	if vm.Err == errProgramExit {
+		vm.Err = nil
+		vm.exited = true
+	}
+	return done
+}
+
+func (vm *VM) step() {
+	if vm.PC < 0 || vm.PC >= len(vm.Code) {
+		vm.fail("execution went outside the code, at index %v", vm.PC)
+		return
+	}
+	if vm.maxInstructions > 0 && vm.Executed >= vm.maxInstructions {
+		vm.Err = fmt.Errorf(
+			"%w: executed %v instructions", ErrBudgetExceeded, vm.Executed,
+		)
 		return
 	}
-	for vm.Err == nil {
-		i := vm.Code[vm.PC]
+	if vm.Trace != nil {
+		vm.traceStep()
+	} else {
+		i := &vm.Code[vm.PC]
 		vm.PC++
+		vm.Executed++
 		i.Op(vm, i.Arg)
 	}
 	if vm.Err == errProgramExit {
 		vm.Err = nil
+		vm.exited = true
 	}
 }
 
@@ -51,27 +245,60 @@ func (vm *VM) fail(format string, args ...interface{}) {
 	}
 }
 
+func (vm *VM) divisionByZero() {
+	if vm.Err == nil {
+		vm.Err = fmt.Errorf(
+			"%w at instruction %v", ErrDivisionByZero, vm.PC-1,
+		)
+	}
+}
+
 func (vm *VM) translate(code []ast.Command) {
 	labels := map[string]int64{}
 	update := map[int]string{}
 	maxLabel := -1
 	var out []Instr
+	ops := vmOps
+	switch {
+	case vm.big:
+		ops = bigOps
+	case vm.checked:
+		ops = checkedOps
+	}
+	if vm.div == DivFloor {
+		if vm.big {
+			ops[ast.CmdDiv] = (*VM).opBigFloorDiv
+			ops[ast.CmdMod] = (*VM).opBigFloorMod
+		} else {
+			ops[ast.CmdDiv] = (*VM).opFloorDiv
+			ops[ast.CmdMod] = (*VM).opFloorMod
+		}
+	}
 	for i, from := range code {
 		if from.Cmd <= ast.CmdNone || from.Cmd >= ast.CountCmds {
 			vm.fail("index %v: invalid command: %v", i, from.Cmd)
 			return
 		}
 		inst := Instr{
-			Op: vmOps[from.Cmd],
+			Op:  ops[from.Cmd],
+			Cmd: from.Cmd,
+			Pos: from.Pos,
 		}
 		switch from.Cmd {
-		case ast.CmdPush, ast.CmdCopy, ast.CmdSlide:
-			v, ok := from.Arg.(int64)
+		case ast.CmdPush:
+			if vm.big {
+				v, ok := vm.bigArg(i, from.Arg)
+				if !ok {
+					return
+				}
+				inst.Arg = int64(len(vm.consts))
+				vm.consts = append(vm.consts, v)
+				break
+			}
+			fallthrough
+		case ast.CmdCopy, ast.CmdSlide:
+			v, ok := vm.intArg(i, from.Arg)
 			if !ok {
-				vm.fail(
-					"index %v: expected int64 argument, got %T",
-					i, from.Arg,
-				)
 				return
 			}
 			inst.Arg = v
@@ -129,6 +356,39 @@ func (vm *VM) translate(code []ast.Command) {
 	}
 
 	vm.Code = out
+	vm.Labels = make(map[string]int, len(labels))
+	for lbl, pos := range labels {
+		vm.Labels[lbl] = int(pos)
+	}
+}
+
+// intArg returns the given number argument as an int64.
+func (vm *VM) intArg(i int, arg interface{}) (int64, bool) {
+	switch v := arg.(type) {
+	case int64:
+		return v, true
+	case *big.Int:
+		if v.IsInt64() {
+			return v.Int64(), true
+		}
+		vm.fail("index %v: number too large for int64: %v", i, v)
+	default:
+		vm.fail("index %v: expected int64 argument, got %T", i, arg)
+	}
+	return 0, false
+}
+
+// bigArg returns the given number argument as a *big.Int.
+func (vm *VM) bigArg(i int, arg interface{}) (*big.Int, bool) {
+	switch v := arg.(type) {
+	case int64:
+		return big.NewInt(v), true
+	case *big.Int:
+		return v, true
+	default:
+		vm.fail("index %v: expected number argument, got %T", i, arg)
+	}
+	return nil, false
 }
 
 func (vm *VM) stackSize(n int) bool {
@@ -139,6 +399,20 @@ func (vm *VM) stackSize(n int) bool {
 	return vm.Err == nil
 }
 
+// stackArg checks that the argument of a copy or slide instruction is a
+// valid index into a stack of the given size, counting from the top.
+func (vm *VM) stackArg(arg int64, size int) bool {
+	if arg < 0 {
+		vm.fail("negative stack index: %v", arg)
+		return false
+	}
+	if arg >= int64(size) {
+		vm.fail("stack underflow")
+		return false
+	}
+	return vm.Err == nil
+}
+
 func (vm *VM) pop() int64 {
 	p := len(vm.Stack) - 1
 	v := vm.Stack[p]
@@ -147,18 +421,11 @@ func (vm *VM) pop() int64 {
 }
 
 func (vm *VM) storeHeap(adr, val int64) {
-	switch {
-	case adr < 0:
+	if adr < 0 {
 		vm.fail("store to negative heap address: %v = %v", adr, val)
 		return
-	case int64(len(vm.Heap)) > adr:
-		// Nothing to do
-	case int64(cap(vm.Heap)) > adr:
-		vm.Heap = vm.Heap[:adr+1]
-	default:
-		for int64(len(vm.Heap)) <= adr {
-			vm.Heap = append(vm.Heap[:cap(vm.Heap)], 0)
-		}
 	}
-	vm.Heap[adr] = val
+	if vm.heapRoom(adr, vm.Heap.CellsAfter(adr)) {
+		vm.Heap.Store(adr, val)
+	}
 }
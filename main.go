@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 
@@ -8,29 +12,66 @@ import (
 	"github.com/edorfaus/whitespace/parser"
 )
 
+// stdin is shared by the program and the debugger, so that input that
+// has been buffered by one of them is not lost to the other.
+var stdin = bufio.NewReader(os.Stdin)
+
 func main() {
+	flag.Parse()
 	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
+		var list parser.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				fmt.Fprintln(os.Stderr, "Error:", e)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
 		os.Exit(1)
 	}
 }
 
+// commands holds the commands that can be given before the file name.
+var commands = map[string]func(fn string) error{
+	"run":    runProgram,
+	"asm":    assembleProgram,
+	"debug":  debugProgram,
+	"disasm": disasmProgram,
+}
+
 func run() error {
+	args := flag.Args()
+	cmd := "run"
+	if len(args) > 0 && commands[args[0]] != nil {
+		// Allow flags after the command as well as before it.
+		cmd = args[0]
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			return err
+		}
+		args = flag.Args()
+	}
+
 	fn := "hello-world.ws"
-	if len(os.Args) > 1 {
-		fn = os.Args[1]
+	if len(args) > 0 {
+		fn = args[0]
 	}
-	p, err := parseFile(fn)
+	return commands[cmd](fn)
+}
+
+func runProgram(fn string) error {
+	vm, err := loadProgram(fn)
 	if err != nil {
 		return err
 	}
 
-	vm := interp.NewVM(p.Commands)
-	if vm.Err != nil {
-		return vm.Err
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
 	}
 
-	vm.Run()
+	vm.RunContext(ctx)
 	if vm.Err != nil {
 		return vm.Err
 	}
@@ -38,6 +79,25 @@ func run() error {
 	return nil
 }
 
+// loadProgram parses the given file, and returns a VM ready to run it.
+func loadProgram(fn string) (*interp.VM, error) {
+	p, err := parseFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := vmOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	vm := interp.NewVM(p.Commands, opts...)
+	if vm.Err != nil {
+		return nil, vm.Err
+	}
+	return vm, nil
+}
+
 func parseFile(fn string) (par *parser.Parser, retErr error) {
 	f, err := os.Open(fn)
 	if err != nil {
@@ -49,7 +109,15 @@ func parseFile(fn string) (par *parser.Parser, retErr error) {
 		}
 	}()
 
-	p := parser.New(f)
+	var opts []parser.Option
+	if *allErrors {
+		opts = append(opts, parser.WithRecovery())
+	}
+	if *bigInts {
+		opts = append(opts, parser.WithBigNumbers())
+	}
+
+	p := parser.New(f, opts...)
 	p.Parse()
 
 	return p, p.Err()
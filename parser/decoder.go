@@ -0,0 +1,320 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// Decoder decodes the commands of a program one at a time, as they are
+// read from the source, without keeping them in memory.
+//
+// It is what Parser uses to parse the whole program, and can be used
+// directly by interpreters that execute the program as they read it.
+type Decoder struct {
+	state state
+
+	src io.ByteReader
+	err error
+
+	// recover enables recovery mode, and errs holds the syntax errors
+	// that have been recovered from.
+	recover bool
+	errs    ErrorList
+
+	// big enables big numbers, and bits is a buffer for parseNumber.
+	big  bool
+	bits []bool
+
+	// instr holds the IMP and command bytes of the current command.
+	instr []byte
+
+	// next is the position of the next byte to be read from the source,
+	// pos is the position of the byte last returned by scan, and start
+	// is the position of the start of the current command.
+	next, pos, start ast.Pos
+
+	// b is the byte last returned by scan.
+	b byte
+
+	// cmd is the command that was decoded, if done is true.
+	cmd  ast.Command
+	done bool
+}
+
+// NewDecoder returns a decoder that reads the source of a program from
+// r, which it reads one byte at a time, so if r is not an io.ByteReader
+// it is wrapped in a bufio.Reader.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	d := &Decoder{}
+	d.Reset(r, ast.StartPos)
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Reset makes the decoder continue decoding from r, as if it were at the
+// given position in the source, discarding any partly decoded command.
+// This is used after seeking in the source. If the line and column of
+// the position are not known, they can be 0, and are then not tracked.
+func (d *Decoder) Reset(r io.Reader, pos ast.Pos) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	d.src = br
+	d.state = stateStart
+	d.next, d.start = pos, pos
+}
+
+// Next decodes and returns the next command. At the end of the source,
+// it returns io.EOF.
+//
+// In recovery mode, syntax errors are recorded and skipped instead of
+// returned, and can be gotten from Errors or Err after reaching the end.
+// Any other error stops the decoder, and is returned again by later
+// calls to Next.
+func (d *Decoder) Next() (ast.Command, error) {
+	d.done = false
+	for d.err == nil && !d.done && d.scan() {
+		if d.state.n == stateStart.n {
+			d.start = d.pos
+			d.instr = d.instr[:0]
+		}
+		d.instr = append(d.instr, d.b)
+		d.state.f(d, d.b)
+		if d.recover && d.err != nil {
+			d.resync()
+		}
+	}
+	if d.done {
+		return d.cmd, nil
+	}
+	if d.err == nil && d.state.n != stateStart.n {
+		d.fail(KindUnexpectedEOF, "unexpected EOF in state %v", d.state.n)
+		if d.recover {
+			d.resync()
+		}
+	}
+	if d.err != nil {
+		return ast.Command{}, d.err
+	}
+	return ast.Command{}, io.EOF
+}
+
+// Pos returns the position of the next byte to be read from the source,
+// which is just after the command that was last returned by Next.
+func (d *Decoder) Pos() ast.Pos {
+	return d.next
+}
+
+// Err returns the error that stopped the decoder, if any. In recovery
+// mode, it otherwise returns an ErrorList holding the syntax errors that
+// were recovered from, if there were any.
+func (d *Decoder) Err() error {
+	if d.err != nil {
+		return d.err
+	}
+	return d.errs.Err()
+}
+
+// Errors returns the syntax errors that were recovered from, which is
+// only done in recovery mode.
+func (d *Decoder) Errors() ErrorList {
+	return d.errs
+}
+
+// scan reads the next whitespace byte from the source into b, skipping
+// any other bytes while keeping track of the source position. It returns
+// false at the end of the source, or if reading it fails.
+func (d *Decoder) scan() bool {
+	for {
+		b, err := d.src.ReadByte()
+		if err != nil {
+			if err != io.EOF && d.err == nil {
+				d.err = err
+			}
+			return false
+		}
+		switch b {
+		case ' ', '\t', '\n':
+			d.pos = d.next
+			d.next.Advance(b)
+			d.b = b
+			return true
+		}
+		d.next.Advance(b)
+	}
+}
+
+// resync records the current syntax error and resets the decoder to
+// continue at the most likely start of the next command.
+//
+// That is the byte after the last one that was read, since the bytes
+// that were read cannot be part of a valid command.
+func (d *Decoder) resync() {
+	se, ok := d.err.(*SyntaxError)
+	if !ok {
+		// Not a syntax error (e.g. a read error), cannot recover.
+		return
+	}
+	d.errs = append(d.errs, se)
+	d.err = nil
+	d.state = stateStart
+}
+
+func (d *Decoder) addCommand(c ast.Cmd, a interface{}) {
+	if d.err != nil {
+		// Do not add a command that failed to parse
+		return
+	}
+	d.cmd = ast.Command{Cmd: c, Arg: a, Pos: d.start}
+	d.done = true
+	d.state = stateStart
+}
+
+func (d *Decoder) parseLabel() string {
+	if d.err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for {
+		if !d.mustScan("a label") {
+			return ""
+		}
+		switch d.b {
+		case ' ', '\t':
+			sb.WriteByte(d.b)
+		case '\n':
+			return sb.String()
+		default:
+			d.badByte(d.b)
+			return ""
+		}
+	}
+}
+
+// parseNumber parses a number argument, returning it as an int64, or as
+// a *big.Int if big numbers are enabled.
+func (d *Decoder) parseNumber() interface{} {
+	if d.err != nil {
+		return nil
+	}
+
+	// First read the sign byte
+	if !d.mustScan("sign for number") {
+		return nil
+	}
+	neg := false
+	switch d.b {
+	case ' ':
+		// positive
+	case '\t':
+		neg = true
+	case '\n':
+		d.fail(
+			KindMissingSign, "unexpected LF, expected a sign (space/tab)",
+		)
+		return nil
+	default:
+		d.badByte(d.b)
+		return nil
+	}
+
+	// Then read the bits of the number, skipping leading zeroes
+	d.bits = d.bits[:0]
+	for {
+		if !d.mustScan("a number") {
+			return nil
+		}
+		switch d.b {
+		case ' ':
+			if len(d.bits) > 0 {
+				d.bits = append(d.bits, false)
+			}
+		case '\t':
+			d.bits = append(d.bits, true)
+		case '\n':
+			return d.makeNumber(neg)
+		default:
+			d.badByte(d.b)
+			return nil
+		}
+		if !d.big && len(d.bits) > 63 {
+			// Fail right away, instead of buffering an unlimited number
+			// of bits that cannot be used anyway.
+			d.fail(
+				KindNumberOverflow,
+				"number too large for implementation (>63 bits)",
+			)
+			return nil
+		}
+	}
+}
+
+// makeNumber converts the bits that were read by parseNumber to a value.
+func (d *Decoder) makeNumber(neg bool) interface{} {
+	if d.big {
+		value := new(big.Int)
+		for i, bit := range d.bits {
+			if bit {
+				value.SetBit(value, len(d.bits)-1-i, 1)
+			}
+		}
+		if neg {
+			value.Neg(value)
+		}
+		return value
+	}
+
+	value := int64(0)
+	for _, bit := range d.bits {
+		value <<= 1
+		if bit {
+			value |= 1
+		}
+	}
+	if neg {
+		return -value
+	}
+	return value
+}
+
+func (d *Decoder) mustScan(during string) bool {
+	if d.err == nil && !d.scan() {
+		d.unexpectedEOF(during)
+	}
+	return d.err == nil
+}
+
+func (d *Decoder) fail(kind ErrorKind, format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	d.err = &SyntaxError{
+		Kind:  kind,
+		Pos:   d.start,
+		State: d.state.n,
+		Bytes: append([]byte(nil), d.instr...),
+		Msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (d *Decoder) badByte(b byte) {
+	d.fail(
+		KindUnexpectedByte, "unexpected byte from scanner: %02X '%c'", b, b,
+	)
+}
+
+func (d *Decoder) badCommand(what string) {
+	d.fail(KindInvalidCommand, "invalid command: %v", what)
+}
+
+func (d *Decoder) unexpectedEOF(during string) {
+	d.fail(KindUnexpectedEOF, "unexpected EOF while reading %s", during)
+}
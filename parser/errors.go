@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/edorfaus/whitespace/ast"
+)
+
+// ErrorKind identifies the kind of problem a SyntaxError describes.
+type ErrorKind uint8
+
+const (
+	// KindUnexpectedEOF means the source ended in the middle of a command.
+	KindUnexpectedEOF ErrorKind = iota + 1
+	// KindInvalidCommand means the IMP and command bytes do not form a
+	// valid command.
+	KindInvalidCommand
+	// KindMissingSign means a number argument did not start with a sign.
+	KindMissingSign
+	// KindNumberOverflow means a number argument was too large for the
+	// implementation.
+	KindNumberOverflow
+	// KindUnexpectedByte means the scanner returned a byte that is not
+	// whitespace. This indicates a bug in the parser.
+	KindUnexpectedByte
+)
+
+var kindNames = [...]string{
+	KindUnexpectedEOF:  "unexpected EOF",
+	KindInvalidCommand: "invalid command",
+	KindMissingSign:    "missing sign",
+	KindNumberOverflow: "number overflow",
+	KindUnexpectedByte: "unexpected byte",
+}
+
+func (k ErrorKind) String() string {
+	if int(k) < len(kindNames) && kindNames[k] != "" {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("ErrorKind(%d)", uint8(k))
+}
+
+// SyntaxError describes a problem with the source code of a program.
+type SyntaxError struct {
+	Kind ErrorKind
+	// Pos is the position of the start of the command that has the error.
+	Pos ast.Pos
+	// State is the name of the parser state the error occurred in.
+	State string
+	// Bytes holds the IMP and command bytes that had been read for the
+	// command when the error occurred, not including any argument.
+	Bytes []byte
+	// Msg is a human-readable description of the error.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of syntax errors, in the order they were found.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", l[0], len(l)-1)
+}
+
+// Unwrap returns the errors in the list, which lets errors.Is and
+// errors.As find them (with Go 1.20 or later).
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// As sets target to the first error in the list that matches it, as
+// errors.As does, which lets errors.As find them with older versions of
+// Go as well.
+func (l ErrorList) As(target interface{}) bool {
+	for _, e := range l {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns nil if the list is empty, and the list itself otherwise.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -5,7 +5,7 @@ import (
 )
 
 type state struct {
-	f func(*Parser, byte)
+	f func(*Decoder, byte)
 	n string
 }
 
@@ -13,243 +13,243 @@ var stateStart state
 
 func init() {
 	// Cannot be in the variable initializer because it causes a loop
-	stateStart = state{(*Parser).stateStart, "start"}
+	stateStart = state{(*Decoder).stateStart, "start"}
 }
 
-func (p *Parser) stateStart(b byte) {
+func (d *Decoder) stateStart(b byte) {
 	switch b {
 	case ' ':
-		p.state = stateStackManip
+		d.state = stateStackManip
 	case '\t':
-		p.state = stateImpTab
+		d.state = stateImpTab
 	case '\n':
-		p.state = stateFlowControl
+		d.state = stateFlowControl
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateImpTab = state{(*Parser).stateImpTab, "impTab"}
+var stateImpTab = state{(*Decoder).stateImpTab, "impTab"}
 
-func (p *Parser) stateImpTab(b byte) {
+func (d *Decoder) stateImpTab(b byte) {
 	switch b {
 	case ' ':
-		p.state = stateArithmetic
+		d.state = stateArithmetic
 	case '\t':
-		p.state = stateHeapAccess
+		d.state = stateHeapAccess
 	case '\n':
-		p.state = stateIO
+		d.state = stateIO
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateArithmetic = state{(*Parser).stateArithmetic, "arithmetic"}
+var stateArithmetic = state{(*Decoder).stateArithmetic, "arithmetic"}
 
-func (p *Parser) stateArithmetic(b byte) {
+func (d *Decoder) stateArithmetic(b byte) {
 	switch b {
 	case ' ':
-		p.state = stateArithSpace
+		d.state = stateArithSpace
 	case '\t':
-		p.state = stateArithTab
+		d.state = stateArithTab
 	case '\n':
-		p.badCommand("Arithmetic/LF")
+		d.badCommand("Arithmetic/LF")
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateArithSpace = state{(*Parser).stateArithSpace, "arithSpace"}
+var stateArithSpace = state{(*Decoder).stateArithSpace, "arithSpace"}
 
-func (p *Parser) stateArithSpace(b byte) {
+func (d *Decoder) stateArithSpace(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdAdd, nil)
+		d.addCommand(ast.CmdAdd, nil)
 	case '\t':
-		p.addCommand(ast.CmdSub, nil)
+		d.addCommand(ast.CmdSub, nil)
 	case '\n':
-		p.addCommand(ast.CmdMul, nil)
+		d.addCommand(ast.CmdMul, nil)
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateArithTab = state{(*Parser).stateArithTab, "arithTab"}
+var stateArithTab = state{(*Decoder).stateArithTab, "arithTab"}
 
-func (p *Parser) stateArithTab(b byte) {
+func (d *Decoder) stateArithTab(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdDiv, nil)
+		d.addCommand(ast.CmdDiv, nil)
 	case '\t':
-		p.addCommand(ast.CmdMod, nil)
+		d.addCommand(ast.CmdMod, nil)
 	case '\n':
-		p.badCommand("Arithmetic/Tab/LF")
+		d.badCommand("Arithmetic/Tab/LF")
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateStackManip = state{(*Parser).stateStackManip, "stackManip"}
+var stateStackManip = state{(*Decoder).stateStackManip, "stackManip"}
 
-func (p *Parser) stateStackManip(b byte) {
+func (d *Decoder) stateStackManip(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdPush, p.parseNumber())
+		d.addCommand(ast.CmdPush, d.parseNumber())
 	case '\t':
-		p.state = stateStackManipTab
+		d.state = stateStackManipTab
 	case '\n':
-		p.state = stateStackManipLF
+		d.state = stateStackManipLF
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateStackManipTab = state{(*Parser).stateStackManipTab, "stackManipTab"}
+var stateStackManipTab = state{(*Decoder).stateStackManipTab, "stackManipTab"}
 
-func (p *Parser) stateStackManipTab(b byte) {
+func (d *Decoder) stateStackManipTab(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdCopy, p.parseNumber())
+		d.addCommand(ast.CmdCopy, d.parseNumber())
 	case '\t':
-		p.badCommand("Stack Manipulation/Tab/Tab")
+		d.badCommand("Stack Manipulation/Tab/Tab")
 	case '\n':
-		p.addCommand(ast.CmdSlide, p.parseNumber())
+		d.addCommand(ast.CmdSlide, d.parseNumber())
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateStackManipLF = state{(*Parser).stateStackManipLF, "stackManipLF"}
+var stateStackManipLF = state{(*Decoder).stateStackManipLF, "stackManipLF"}
 
-func (p *Parser) stateStackManipLF(b byte) {
+func (d *Decoder) stateStackManipLF(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdDup, nil)
+		d.addCommand(ast.CmdDup, nil)
 	case '\t':
-		p.addCommand(ast.CmdSwap, nil)
+		d.addCommand(ast.CmdSwap, nil)
 	case '\n':
-		p.addCommand(ast.CmdDiscard, nil)
+		d.addCommand(ast.CmdDiscard, nil)
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateHeapAccess = state{(*Parser).stateHeapAccess, "heapAccess"}
+var stateHeapAccess = state{(*Decoder).stateHeapAccess, "heapAccess"}
 
-func (p *Parser) stateHeapAccess(b byte) {
+func (d *Decoder) stateHeapAccess(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdStore, nil)
+		d.addCommand(ast.CmdStore, nil)
 	case '\t':
-		p.addCommand(ast.CmdRetrieve, nil)
+		d.addCommand(ast.CmdRetrieve, nil)
 	case '\n':
-		p.badCommand("Heap Access/LF")
+		d.badCommand("Heap Access/LF")
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateIO = state{(*Parser).stateIO, "io"}
+var stateIO = state{(*Decoder).stateIO, "io"}
 
-func (p *Parser) stateIO(b byte) {
+func (d *Decoder) stateIO(b byte) {
 	switch b {
 	case ' ':
-		p.state = stateIOSpace
+		d.state = stateIOSpace
 	case '\t':
-		p.state = stateIOTab
+		d.state = stateIOTab
 	case '\n':
-		p.badCommand("IO/LF")
+		d.badCommand("IO/LF")
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateIOSpace = state{(*Parser).stateIOSpace, "ioSpace"}
+var stateIOSpace = state{(*Decoder).stateIOSpace, "ioSpace"}
 
-func (p *Parser) stateIOSpace(b byte) {
+func (d *Decoder) stateIOSpace(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdOutChar, nil)
+		d.addCommand(ast.CmdOutChar, nil)
 	case '\t':
-		p.addCommand(ast.CmdOutNumber, nil)
+		d.addCommand(ast.CmdOutNumber, nil)
 	case '\n':
-		p.badCommand("IO/Space/LF")
+		d.badCommand("IO/Space/LF")
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateIOTab = state{(*Parser).stateIOTab, "ioTab"}
+var stateIOTab = state{(*Decoder).stateIOTab, "ioTab"}
 
-func (p *Parser) stateIOTab(b byte) {
+func (d *Decoder) stateIOTab(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdReadChar, nil)
+		d.addCommand(ast.CmdReadChar, nil)
 	case '\t':
-		p.addCommand(ast.CmdReadNumber, nil)
+		d.addCommand(ast.CmdReadNumber, nil)
 	case '\n':
-		p.badCommand("IO/Tab/LF")
+		d.badCommand("IO/Tab/LF")
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateFlowControl = state{(*Parser).stateFlowControl, "flowControl"}
+var stateFlowControl = state{(*Decoder).stateFlowControl, "flowControl"}
 
-func (p *Parser) stateFlowControl(b byte) {
+func (d *Decoder) stateFlowControl(b byte) {
 	switch b {
 	case ' ':
-		p.state = stateFlowControlSpace
+		d.state = stateFlowControlSpace
 	case '\t':
-		p.state = stateFlowControlTab
+		d.state = stateFlowControlTab
 	case '\n':
-		p.state = stateFlowControlLF
+		d.state = stateFlowControlLF
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateFlowControlSpace = state{(*Parser).stateFlowControlSpace, "flowControlSpace"}
+var stateFlowControlSpace = state{(*Decoder).stateFlowControlSpace, "flowControlSpace"}
 
-func (p *Parser) stateFlowControlSpace(b byte) {
+func (d *Decoder) stateFlowControlSpace(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdMark, p.parseLabel())
+		d.addCommand(ast.CmdMark, d.parseLabel())
 	case '\t':
-		p.addCommand(ast.CmdCall, p.parseLabel())
+		d.addCommand(ast.CmdCall, d.parseLabel())
 	case '\n':
-		p.addCommand(ast.CmdJump, p.parseLabel())
+		d.addCommand(ast.CmdJump, d.parseLabel())
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateFlowControlTab = state{(*Parser).stateFlowControlTab, "flowControlTab"}
+var stateFlowControlTab = state{(*Decoder).stateFlowControlTab, "flowControlTab"}
 
-func (p *Parser) stateFlowControlTab(b byte) {
+func (d *Decoder) stateFlowControlTab(b byte) {
 	switch b {
 	case ' ':
-		p.addCommand(ast.CmdJumpIfZero, p.parseLabel())
+		d.addCommand(ast.CmdJumpIfZero, d.parseLabel())
 	case '\t':
-		p.addCommand(ast.CmdJumpIfNeg, p.parseLabel())
+		d.addCommand(ast.CmdJumpIfNeg, d.parseLabel())
 	case '\n':
-		p.addCommand(ast.CmdReturn, nil)
+		d.addCommand(ast.CmdReturn, nil)
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
 
-var stateFlowControlLF = state{(*Parser).stateFlowControlLF, "flowControlLF"}
+var stateFlowControlLF = state{(*Decoder).stateFlowControlLF, "flowControlLF"}
 
-func (p *Parser) stateFlowControlLF(b byte) {
+func (d *Decoder) stateFlowControlLF(b byte) {
 	switch b {
 	case ' ':
-		p.badCommand("Flow Control/LF/Space")
+		d.badCommand("Flow Control/LF/Space")
 	case '\t':
-		p.badCommand("Flow Control/LF/Tab")
+		d.badCommand("Flow Control/LF/Tab")
 	case '\n':
-		p.addCommand(ast.CmdExit, nil)
+		d.addCommand(ast.CmdExit, nil)
 	default:
-		p.badByte(b)
+		d.badByte(b)
 	}
 }
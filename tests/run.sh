@@ -9,7 +9,7 @@ checkInterpreter ./direct
 checkInterpreter ./whitespace
 
 runWS() {
-	"${interpreter[@]}" "$1"
+	"${interpreter[@]}" "${testArgs[@]}" "$1"
 }
 
 fail() {
@@ -25,6 +25,9 @@ fail() {
 parseTest() {
 	testInput=
 	testExpect=
+	testArgs=()
+	testExit=0
+	testNoNewline=
 
 	if ! exec 8< "$1"
 	then
@@ -38,9 +41,15 @@ parseTest() {
 	do
 		[[ "$line" = "input:"* ]] && testInput+="${line:6}"$'\n'
 		[[ "$line" = "output:"* ]] && testExpect+="${line:7}"$'\n'
+		[[ "$line" = "args:"* ]] && testArgs+=("${line:5}")
+		[[ "$line" = "exit:"* ]] && testExit=${line:5}
+	[[ "$line" = "input-no-newline:"* ]] && testNoNewline=1
+		[[ "$line" = "input-no-newline:"* ]] && testNoNewline=1
 	done
 	[[ "$line" = "input:"* ]] && testInput+="${line:6}"$'\n'
 	[[ "$line" = "output:"* ]] && testExpect+="${line:7}"$'\n'
+	[[ "$line" = "args:"* ]] && testArgs+=("${line:5}")
+	[[ "$line" = "exit:"* ]] && testExit=${line:5}
 
 	exec 8<&-
 
@@ -55,18 +64,39 @@ parseTest() {
 	return 0
 }
 
+feedInput() {
+	if [ "$testNoNewline" = "" ]; then
+		printf '%s\n' "$testInput"
+	else
+		printf '%s' "$testInput"
+	fi
+}
+
 runTest() {
 	local exitCode=0
 
 	testState=RUN
-	testOutput=$(runWS "$1" 2>&1 <<<"$testInput") exitCode=$?
+	if [ "$testExit" -eq 0 ]; then
+		testOutput=$(runWS "$1" 2>&1 < <(feedInput)) exitCode=$?
+	else
+		# The error message differs between interpreters, so ignore it.
+		testOutput=$(runWS "$1" 2>/dev/null < <(feedInput)) exitCode=$?
+	fi
 
-	if [ $exitCode -eq 0 ] && [ "$testOutput" = "$testExpect" ]; then
+	if [ $exitCode -eq "$testExit" ] && [ "$testOutput" = "$testExpect" ]
+	then
 		testState=OK
+	elif [ ${#testArgs[@]} -gt 0 ] && [ $exitCode -eq 2 ] &&
+		[ "$testExit" -ne 2 ]
+	then
+		# Exit code 2 is the usual one for usage errors, so assume the
+		# interpreter does not support the arguments of the test.
+		testState=SKIP
 	else
 		testState=FAIL
 
-		[ $exitCode -eq 0 ] || testOutput+=$'\n'"Exit code: $exitCode"
+		[ $exitCode -eq "$testExit" ] ||
+			testOutput+=$'\n'"Exit code: $exitCode"
 	fi
 }
 
@@ -83,7 +113,7 @@ handleTest() {
 
 	counts[$testState]=$(( ${counts[$testState]} +1 ))
 	case "$testState" in
-		OK) ;;
+		OK|SKIP) ;;
 		ERROR) printf "\t%s\n" "$testOutput" ;;
 		FAIL) showOutputs ;;
 		*) showOutputs ;;
@@ -126,4 +156,7 @@ for s in "${!counts[@]}" ; do
 done
 printf "\n"
 
-[ ${#counts[@]} -eq 1 ] && [ "${counts["OK"]}" != "" ]
+for s in "${!counts[@]}" ; do
+	[ "$s" = OK ] || [ "$s" = SKIP ] || exit 1
+done
+[ "${counts["OK"]}" != "" ]